@@ -3,24 +3,24 @@ package main
 import (
 	"context"
 	"log"
+	"net"
 	"net/http"
 	"sync/atomic"
 	"time"
 
-	"github.com/go-chi/chi"
-	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/pressly/lg"
-	"github.com/sirupsen/logrus"
 )
 
 func main() {
 
-	// Setup the logger
-	logger := logrus.New()
-	logger.Formatter = &logrus.JSONFormatter{}
-
-	lg.RedirectStdlogOutput(logger)
-	lg.DefaultLogger = logger
+	// Setup the logger, configured from the LG_* environment variables
+	logger, requestLogger, cleanup, err := lg.Setup(lg.SetupOptions{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer cleanup()
 
 	lg.Infoln("Welcome")
 
@@ -30,11 +30,14 @@ func main() {
 
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID)
-	r.Use(lg.RequestLogger(logger))
+	r.Use(requestLogger)
 	// r.Use(lg.PrintPanics)
 
 	r.Use(Counter)
 
+	r.NotFound(lg.NotFound(nil))
+	r.MethodNotAllowed(lg.MethodNotAllowed(nil))
+
 	r.Get("/", Index)
 	r.Route("/articles", func(r chi.Router) {
 		r.Use(ArticleCtx)
@@ -52,8 +55,12 @@ func main() {
 		}
 	}()
 
-	service := chi.ServerBaseContext(serverCtx, r)
-	http.ListenAndServe(":3333", service)
+	srv := &http.Server{
+		Addr:        ":3333",
+		Handler:     r,
+		BaseContext: func(net.Listener) context.Context { return serverCtx },
+	}
+	srv.ListenAndServe()
 }
 
 var counter = uint64(0)
@@ -0,0 +1,71 @@
+package lg
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// LatencyBaseline tracks the rolling p95 latency of each route, over its last
+// Window requests (100 when zero). Requests taking more than Factor (3 when
+// zero) times the baseline of their route are completed at the warning level
+// with latency_anomaly=true, once the route has MinSamples requests (20 when
+// zero).
+type LatencyBaseline struct {
+	Factor     float64
+	Window     int
+	MinSamples int
+
+	mu     sync.Mutex
+	routes map[string]*latencyWindow
+}
+
+// latencyWindow is a ring buffer of the latest latencies of a route.
+type latencyWindow struct {
+	samples []float64
+	next    int
+}
+
+// observe records the latency of a request to the route and reports whether
+// it's an anomaly against the baseline before it, with that baseline.
+func (b *LatencyBaseline) observe(route string, elapsed time.Duration) (bool, float64) {
+	factor, window, minSamples := b.Factor, b.Window, b.MinSamples
+	if factor <= 0 {
+		factor = 3
+	}
+	if window <= 0 {
+		window = 100
+	}
+	if minSamples <= 0 {
+		minSamples = 20
+	}
+	ms := float64(elapsed.Nanoseconds()) / 1000000.0
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.routes == nil {
+		b.routes = map[string]*latencyWindow{}
+	}
+	w := b.routes[route]
+	if w == nil {
+		w = &latencyWindow{}
+		b.routes[route] = w
+	}
+
+	var p95 float64
+	if len(w.samples) > 0 {
+		sorted := make([]float64, len(w.samples))
+		copy(sorted, w.samples)
+		sort.Float64s(sorted)
+		p95 = percentile(sorted, 0.95)
+	}
+	anomaly := len(w.samples) >= minSamples && ms > factor*p95
+
+	if len(w.samples) < window {
+		w.samples = append(w.samples, ms)
+	} else {
+		w.samples[w.next] = ms
+		w.next = (w.next + 1) % window
+	}
+	return anomaly, p95
+}
@@ -0,0 +1,150 @@
+package lg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Uploader stores an object, such as in an S3 or GCS compatible bucket. It's
+// implemented by applications with the SDK of their object storage, so that
+// lg doesn't depend on any of them.
+type Uploader interface {
+	Upload(ctx context.Context, key string, body io.Reader) error
+}
+
+// ArchiveWriter rolls the lines written to it into gzipped newline-delimited
+// objects, uploaded every interval or once MaxBytes of uncompressed lines
+// are buffered, for cheap archiving of raw access logs. The objects are named
+// <prefix>/2006/01/02/150405.000000000.json.gz after the time of the upload.
+// Upload errors are reported on stderr and the lines of the failed object are
+// lost, so a slow or failing bucket never blocks logging. One object is
+// uploaded at a time: the lines written meanwhile are kept for the next one,
+// up to MaxBytes, beyond which they're dropped.
+type ArchiveWriter struct {
+	MaxBytes int
+
+	uploader Uploader
+	prefix   string
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+	zw  *gzip.Writer
+	n   int
+
+	uploading bool
+	uploads   sync.WaitGroup
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// DefaultArchiveInterval is the interval of an ArchiveWriter created with no
+// interval.
+const DefaultArchiveInterval = 5 * time.Minute
+
+// NewArchiveWriter returns an ArchiveWriter uploading to uploader every
+// interval, or every DefaultArchiveInterval if interval is not positive,
+// under the given key prefix.
+func NewArchiveWriter(uploader Uploader, prefix string, interval time.Duration) *ArchiveWriter {
+	if interval <= 0 {
+		interval = DefaultArchiveInterval
+	}
+	a := &ArchiveWriter{
+		MaxBytes: 64 << 20,
+		uploader: uploader,
+		prefix:   prefix,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	a.zw = gzip.NewWriter(&a.buf)
+	go a.run(interval)
+	return a
+}
+
+func (a *ArchiveWriter) run(interval time.Duration) {
+	defer close(a.done)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-a.stop:
+			return
+		case <-t.C:
+			a.mu.Lock()
+			a.roll()
+			a.mu.Unlock()
+		}
+	}
+}
+
+func (a *ArchiveWriter) Write(p []byte) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.uploading && a.MaxBytes > 0 && a.n >= a.MaxBytes {
+		atomic.AddUint64(&counters.EntriesDropped, 1)
+		return len(p), nil
+	}
+	a.zw.Write(p)
+	a.n += len(p)
+	if a.MaxBytes > 0 && a.n >= a.MaxBytes {
+		a.roll()
+	}
+	return len(p), nil
+}
+
+// roll uploads the current object in the background and starts a new one,
+// unless an upload is in flight.
+func (a *ArchiveWriter) roll() {
+	if a.n == 0 || a.uploading {
+		return
+	}
+	a.zw.Close()
+	body := make([]byte, a.buf.Len())
+	copy(body, a.buf.Bytes())
+	a.buf.Reset()
+	a.zw.Reset(&a.buf)
+	a.n = 0
+
+	key := fmt.Sprintf("%s/%s.json.gz", a.prefix, time.Now().UTC().Format("2006/01/02/150405.000000000"))
+	a.uploading = true
+	a.uploads.Add(1)
+	go func() {
+		defer a.uploads.Done()
+		defer func() {
+			a.mu.Lock()
+			a.uploading = false
+			a.mu.Unlock()
+		}()
+		if err := a.uploader.Upload(context.Background(), key, bytes.NewReader(body)); err != nil {
+			atomic.AddUint64(&counters.SinkErrors, 1)
+			fmt.Fprintf(os.Stderr, "lg: failed to upload log archive %s: %v\n", key, err)
+		}
+	}()
+}
+
+// Close uploads the current object and waits for the pending uploads.
+func (a *ArchiveWriter) Close() error {
+	a.closeOnce.Do(func() { close(a.stop) })
+	<-a.done
+
+	for {
+		a.uploads.Wait()
+		a.mu.Lock()
+		uploading := a.uploading
+		a.roll()
+		a.mu.Unlock()
+		if !uploading {
+			break
+		}
+	}
+	a.uploads.Wait()
+	return nil
+}
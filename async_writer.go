@@ -0,0 +1,202 @@
+package lg
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// AsyncWriter is a writer which never blocks the caller on a slow underlying
+// writer, such as a stalled network sink. Lines are buffered and written by a
+// background goroutine; when the buffer is full, lines are dropped and
+// counted instead, so backpressure shows up as lg_dropped_total rather than
+// as request latency. It's meant to be set as the Out of a logger.
+type AsyncWriter struct {
+	w       io.Writer
+	lines   chan []byte
+	done    chan struct{}
+	dropped uint64
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewAsyncWriter returns an AsyncWriter writing to w, buffering up to size
+// lines.
+func NewAsyncWriter(w io.Writer, size int) *AsyncWriter {
+	a := &AsyncWriter{
+		w:     w,
+		lines: make(chan []byte, size),
+		done:  make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+func (a *AsyncWriter) run() {
+	defer close(a.done)
+	for line := range a.lines {
+		if _, err := a.w.Write(line); err != nil {
+			atomic.AddUint64(&counters.SinkErrors, 1)
+		}
+	}
+}
+
+func (a *AsyncWriter) drop() {
+	atomic.AddUint64(&a.dropped, 1)
+	atomic.AddUint64(&counters.EntriesDropped, 1)
+}
+
+func (a *AsyncWriter) Write(p []byte) (int, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		a.drop()
+		return len(p), nil
+	}
+
+	line := make([]byte, len(p))
+	copy(line, p)
+	select {
+	case a.lines <- line:
+	default:
+		a.drop()
+	}
+	return len(p), nil
+}
+
+// Dropped returns the number of lines dropped so far.
+func (a *AsyncWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&a.dropped)
+}
+
+// Pending returns the number of buffered lines, not yet written.
+func (a *AsyncWriter) Pending() int {
+	return len(a.lines)
+}
+
+// Cap returns the number of lines the writer can buffer.
+func (a *AsyncWriter) Cap() int {
+	return cap(a.lines)
+}
+
+// Close writes the buffered lines and stops the writer. Lines written after
+// Close are dropped.
+func (a *AsyncWriter) Close() error {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.lines)
+	}
+	a.mu.Unlock()
+	<-a.done
+	return nil
+}
+
+// DefaultReportDropsInterval is the interval of ReportDrops when it's given
+// no interval.
+const DefaultReportDropsInterval = time.Minute
+
+// ReportDrops logs a warning with lg_dropped_total to logger every interval
+// in which lines have been dropped, until ctx is done. The interval is
+// DefaultReportDropsInterval if it's not positive.
+func (a *AsyncWriter) ReportDrops(ctx context.Context, logger *logrus.Logger, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultReportDropsInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	var last uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if n := a.Dropped(); n != last {
+				logger.WithFields(logrus.Fields{
+					"lg_dropped_total": n, "lg_dropped": n - last,
+				}).Warnln("lg: log lines dropped")
+				last = n
+			}
+		}
+	}
+}
+
+// The utilization of the buffer of an AsyncWriter above which DegradeLevels
+// stops the debug lines, then the info lines. The levels are restored once
+// the utilization is back under half of the thresholds.
+const (
+	degradeInfoThreshold = 0.5
+	degradeWarnThreshold = 0.8
+)
+
+// DefaultDegradeInterval is the interval of DegradeLevels when it's given no
+// interval.
+const DefaultDegradeInterval = time.Second
+
+// DegradeLevels raises the level of logger as the buffer of the writer fills
+// up during an outage of the sink, checking it every interval until ctx is
+// done: the debug lines stop above 50% of utilization, then the info lines
+// above 80%, so that warnings and errors are still written and the requests
+// don't pay for formatting lines which would be dropped anyway. A line is
+// logged on each change of level, and the level of logger is restored once
+// the buffer drains. The changes of level of logger made meanwhile are kept
+// as the level to restore. The interval is DefaultDegradeInterval if it's not
+// positive.
+func (a *AsyncWriter) DegradeLevels(ctx context.Context, logger *logrus.Logger, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultDegradeInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	base := loggerLevel(logger)
+	degraded := base
+	for {
+		select {
+		case <-ctx.Done():
+			if degraded != base {
+				logger.SetLevel(base)
+			}
+			return
+		case <-t.C:
+		}
+
+		if current := loggerLevel(logger); current != degraded {
+			base, degraded = current, current
+		}
+		u := float64(a.Pending()) / float64(a.Cap())
+		level := degraded
+		switch {
+		case u >= degradeWarnThreshold:
+			level = logrus.WarnLevel
+		case u >= degradeInfoThreshold && degraded > logrus.InfoLevel:
+			level = logrus.InfoLevel
+		case degraded == logrus.WarnLevel && u < degradeWarnThreshold/2 && base > logrus.WarnLevel:
+			level = logrus.InfoLevel
+			if u < degradeInfoThreshold/2 {
+				level = base
+			}
+		case degraded == logrus.InfoLevel && u < degradeInfoThreshold/2:
+			level = base
+		}
+		if level > base {
+			level = base
+		}
+		if level == degraded {
+			continue
+		}
+
+		fields := logrus.Fields{"lg_queue_utilization": u, "lg_level": level.String()}
+		logger.SetLevel(level)
+		if level < degraded {
+			logger.WithFields(fields).Warnln("lg: log level degraded, sink backpressure")
+		} else {
+			logger.WithFields(fields).Warnln("lg: log level restored")
+		}
+		degraded = level
+	}
+}
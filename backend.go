@@ -0,0 +1,67 @@
+package lg
+
+import (
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Level is the severity of a line written to a Backend, the same as the
+// names of the logrus levels.
+type Level string
+
+const (
+	LevelDebug Level = "debug"
+	LevelInfo  Level = "info"
+	LevelWarn  Level = "warning"
+	LevelError Level = "error"
+	LevelFatal Level = "fatal"
+	LevelPanic Level = "panic"
+)
+
+// Backend receives the lines of the request logger created with New, so that
+// it can be wired to any logging library without importing logrus. Log is
+// called as the lines are formatted, outside of the locks of the logger, so
+// it may be called concurrently and a slow Backend delays only the requests
+// logging through it.
+type Backend interface {
+	Log(t time.Time, level Level, msg string, fields map[string]interface{})
+}
+
+// New returns a request logger middleware writing its lines, and the lines
+// logged through Log(ctx) in the requests, to backend. The options are the
+// same as for RequestLogger.
+func New(backend Backend, opts ...Option) func(next http.Handler) http.Handler {
+	logger := &logrus.Logger{
+		Out:       ioutil.Discard,
+		Formatter: backendFormatter{backend},
+		Hooks:     logrus.LevelHooks{},
+		Level:     logrus.DebugLevel,
+	}
+	return RequestLogger(logger, opts...)
+}
+
+// backendFormatter passes the lines of a logger to a Backend instead of
+// formatting them. Unlike the hooks, logrus runs the formatter without
+// holding the lock of the logger.
+type backendFormatter struct {
+	backend Backend
+}
+
+func (f backendFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	fields := make(map[string]interface{}, len(e.Data))
+	for k, v := range e.Data {
+		fields[k] = v
+	}
+	f.backend.Log(e.Time, Level(e.Level.String()), e.Message, fields)
+	return nil, nil
+}
+
+// discardFormatter skips the formatting of the lines of a logger.
+type discardFormatter struct{}
+
+func (discardFormatter) Format(*logrus.Entry) ([]byte, error) {
+	return nil, nil
+}
@@ -0,0 +1,78 @@
+package lg
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"sync"
+)
+
+// maxBodyKeysSize is the maximum number of bytes of a request body kept to
+// find its top-level keys, the keys after it are not logged.
+const maxBodyKeysSize = 64 << 10
+
+// keysBody records the start of a JSON request body as the handler reads it,
+// to log its top-level keys once the request is complete.
+type keysBody struct {
+	io.ReadCloser
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// newKeysBody returns the body of r wrapped to record its keys, or nil if r
+// is not a JSON request.
+func newKeysBody(r *http.Request) *keysBody {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != "application/json" {
+		return nil
+	}
+	return &keysBody{ReadCloser: r.Body}
+}
+
+func (b *keysBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.mu.Lock()
+	if room := maxBodyKeysSize - b.buf.Len(); room > 0 && n > 0 {
+		if n < room {
+			room = n
+		}
+		b.buf.Write(p[:room])
+	}
+	b.mu.Unlock()
+	return n, err
+}
+
+// keys returns the top-level keys of the JSON object of the part of the
+// body read by the handler.
+func (b *keysBody) keys() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	dec := json.NewDecoder(bytes.NewReader(b.buf.Bytes()))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil
+	}
+	keys := []string{}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		key, ok := tok.(string)
+		if !ok {
+			break
+		}
+		keys = append(keys, cleanString(key))
+		// Skip the value, the json decoder tracks the nesting.
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			break
+		}
+	}
+	return keys
+}
@@ -0,0 +1,182 @@
+package lg
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BotAction is what the request logger does with the requests of bots.
+type BotAction int
+
+const (
+	// BotTag logs the requests of bots with is_bot=true.
+	BotTag BotAction = iota
+	// BotSample also logs the info lines of only SampleRate of them.
+	BotSample
+	// BotSkip also logs only the warnings and errors of them.
+	BotSkip
+)
+
+// DefaultBotPatterns are the user agent substrings, in lower case, of the
+// common bots and crawlers.
+var DefaultBotPatterns = []string{
+	"bot", "crawler", "spider", "slurp", "crawl", "facebookexternalhit",
+	"bingpreview", "mediapartners-google", "headlesschrome", "python-requests",
+	"curl/", "wget/", "go-http-client",
+}
+
+// KnownCrawlers are the user agent substrings, in lower case, of the crawlers
+// which can be verified with a reverse DNS lookup of the client address, with
+// the domains their hosts belong to.
+var KnownCrawlers = map[string][]string{
+	"googlebot":   {".googlebot.com", ".google.com"},
+	"bingbot":     {".search.msn.com"},
+	"applebot":    {".applebot.apple.com"},
+	"duckduckbot": {".duckduckgo.com"},
+	"yandexbot":   {".yandex.ru", ".yandex.net", ".yandex.com"},
+	"baiduspider": {".baidu.com", ".baidu.jp"},
+}
+
+// maxVerifiedCrawlers is the number of client addresses of which the crawler
+// verification is cached.
+const maxVerifiedCrawlers = 10000
+
+// maxPendingVerifications is the number of crawler verifications in progress,
+// beyond which the requests of new addresses are not verified.
+const maxPendingVerifications = 64
+
+// verifyTimeout bounds the DNS lookups of a crawler verification.
+const verifyTimeout = 5 * time.Second
+
+// BotDetector detects the requests of bots and crawlers, which often dominate
+// the access logs of public sites, from their user agent. The requests of
+// bots are logged with is_bot=true, and sampled or skipped depending on
+// Action.
+//
+// With Verify, the requests claiming to come from one of the KnownCrawlers
+// are verified with a reverse and forward DNS lookup of the client address,
+// logged as bot_verified. The lookups run in the background and are cached by
+// address, so the first requests of an address are logged before the lookups
+// complete, without bot_verified.
+type BotDetector struct {
+	Action     BotAction
+	SampleRate float64
+
+	// Patterns are the user agent substrings of the bots, in lower case,
+	// DefaultBotPatterns when nil.
+	Patterns []string
+
+	// IsBot, if set, detects bots in addition to the patterns, such as from
+	// a list of client addresses.
+	IsBot func(r *http.Request) bool
+
+	Verify bool
+
+	mu       sync.Mutex
+	verified map[string]bool
+	pending  map[string]bool
+}
+
+// detect reports whether r comes from a bot, and whether it was verified to
+// come from a known crawler when verification applies.
+func (d *BotDetector) detect(r *http.Request) (isBot bool, verified *bool) {
+	ua := strings.ToLower(r.UserAgent())
+	patterns := d.Patterns
+	if patterns == nil {
+		patterns = DefaultBotPatterns
+	}
+	for _, p := range patterns {
+		if strings.Contains(ua, p) {
+			isBot = true
+			break
+		}
+	}
+	if !isBot && d.IsBot != nil {
+		isBot = d.IsBot(r)
+	}
+	if !d.Verify {
+		return isBot, nil
+	}
+	for name, domains := range KnownCrawlers {
+		if strings.Contains(ua, name) {
+			if ok, done := d.verify(r.RemoteAddr, domains); done {
+				return true, &ok
+			}
+			return true, nil
+		}
+	}
+	return isBot, nil
+}
+
+// verify reports whether the host of addr belongs to one of domains, with a
+// reverse DNS lookup confirmed by a forward lookup, if done is set. Otherwise
+// the lookups are started in the background, or already in progress.
+func (d *BotDetector) verify(addr string, domains []string) (ok, done bool) {
+	ip, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		ip = addr
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if ok, cached := d.verified[ip]; cached {
+		return ok, true
+	}
+	if d.pending == nil {
+		d.pending = map[string]bool{}
+	}
+	if d.pending[ip] || len(d.pending) >= maxPendingVerifications {
+		return false, false
+	}
+	d.pending[ip] = true
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), verifyTimeout)
+		defer cancel()
+		ok := verifyHost(ctx, ip, domains)
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		delete(d.pending, ip)
+		if d.verified == nil {
+			d.verified = map[string]bool{}
+		}
+		if len(d.verified) >= maxVerifiedCrawlers {
+			// Evicts an arbitrary address.
+			for k := range d.verified {
+				delete(d.verified, k)
+				break
+			}
+		}
+		d.verified[ip] = ok
+	}()
+	return false, false
+}
+
+func verifyHost(ctx context.Context, ip string, domains []string) bool {
+	names, err := net.DefaultResolver.LookupAddr(ctx, ip)
+	if err != nil {
+		return false
+	}
+	for _, name := range names {
+		name = strings.TrimSuffix(name, ".")
+		for _, domain := range domains {
+			if !strings.HasSuffix(name, domain) {
+				continue
+			}
+			addrs, err := net.DefaultResolver.LookupHost(ctx, name)
+			if err != nil {
+				continue
+			}
+			for _, a := range addrs {
+				if a == ip {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package lg
+
+import (
+	"runtime"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ReportCaller adds the caller_file, caller_line and caller_func fields to the
+// loggers returned by Log, RequestLog and Named, pointing at the code calling
+// them rather than at lg. It's off by default, as it has a cost on every call.
+var ReportCaller bool
+
+// CallerSkip is the number of additional stack frames to skip when reporting
+// the caller, for applications wrapping Log in their own helpers.
+var CallerSkip int
+
+// withCaller adds the caller fields to logger when ReportCaller is set. skip
+// is the number of frames to skip above the caller of withCaller.
+func withCaller(logger logrus.FieldLogger, skip int) logrus.FieldLogger {
+	if !ReportCaller {
+		return logger
+	}
+	pc, file, line, ok := runtime.Caller(skip + 1 + CallerSkip)
+	if !ok {
+		return logger
+	}
+	fields := logrus.Fields{"caller_file": file, "caller_line": line}
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		fields["caller_func"] = fn.Name()
+	}
+	return logger.WithFields(fields)
+}
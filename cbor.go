@@ -0,0 +1,141 @@
+package lg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// CBORFormatter formats the entries as CBOR maps (RFC 8949), with the same
+// keys as the logrus JSON formatter (time, level, msg and the fields), for
+// shippers sensitive to bandwidth. The records are self-delimiting, and can be
+// read back with the lg/cbor package.
+type CBORFormatter struct{}
+
+// The major types of CBOR.
+const (
+	cborUint   = 0 << 5
+	cborNegInt = 1 << 5
+	cborText   = 3 << 5
+	cborArray  = 4 << 5
+	cborMap    = 5 << 5
+)
+
+func (f *CBORFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	keys := make([]string, 0, len(entry.Data))
+	for k := range entry.Data {
+		if k != "time" && k != "level" && k != "msg" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	b := cborAppendHeader(nil, cborMap, uint64(len(keys)+3))
+	b = cborAppendString(b, "time")
+	b = cborAppendString(b, entry.Time.Format(time.RFC3339Nano))
+	b = cborAppendString(b, "level")
+	b = cborAppendString(b, entry.Level.String())
+	b = cborAppendString(b, "msg")
+	b = cborAppendString(b, entry.Message)
+	for _, k := range keys {
+		b = cborAppendString(b, k)
+		b = cborAppendValue(b, entry.Data[k])
+	}
+	return b, nil
+}
+
+func cborAppendValue(b []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0xf6)
+	case bool:
+		if v {
+			return append(b, 0xf5)
+		}
+		return append(b, 0xf4)
+	case int:
+		return cborAppendInt(b, int64(v))
+	case int32:
+		return cborAppendInt(b, int64(v))
+	case int64:
+		return cborAppendInt(b, v)
+	case uint32:
+		return cborAppendInt(b, int64(v))
+	case float32:
+		return cborAppendFloat(b, float64(v))
+	case float64:
+		return cborAppendFloat(b, v)
+	case string:
+		return cborAppendString(b, v)
+	case error:
+		return cborAppendString(b, v.Error())
+	case []string:
+		b = cborAppendHeader(b, cborArray, uint64(len(v)))
+		for _, s := range v {
+			b = cborAppendString(b, s)
+		}
+		return b
+	case map[string]interface{}:
+		return cborAppendMap(b, v)
+	case logrus.Fields:
+		return cborAppendMap(b, v)
+	default:
+		return cborAppendString(b, fmt.Sprintf("%+v", v))
+	}
+}
+
+func cborAppendMap(b []byte, m map[string]interface{}) []byte {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	b = cborAppendHeader(b, cborMap, uint64(len(keys)))
+	for _, k := range keys {
+		b = cborAppendString(b, k)
+		b = cborAppendValue(b, m[k])
+	}
+	return b
+}
+
+func cborAppendInt(b []byte, v int64) []byte {
+	if v < 0 {
+		return cborAppendHeader(b, cborNegInt, uint64(-1-v))
+	}
+	return cborAppendHeader(b, cborUint, uint64(v))
+}
+
+func cborAppendFloat(b []byte, v float64) []byte {
+	b = append(b, 0xfb)
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], math.Float64bits(v))
+	return append(b, buf[:]...)
+}
+
+func cborAppendString(b []byte, s string) []byte {
+	b = cborAppendHeader(b, cborText, uint64(len(s)))
+	return append(b, s...)
+}
+
+// cborAppendHeader appends the head of a data item of the given major type,
+// with its argument n in the shortest form.
+func cborAppendHeader(b []byte, major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(b, major|byte(n))
+	case n < 1<<8:
+		return append(b, major|24, byte(n))
+	case n < 1<<16:
+		return append(b, major|25, byte(n>>8), byte(n))
+	case n < 1<<32:
+		return append(b, major|26, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	b = append(b, major|27)
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], n)
+	return append(b, buf[:]...)
+}
@@ -0,0 +1,220 @@
+// Package cbor decodes the records written by lg.CBORFormatter, to inspect
+// binary logs locally, such as:
+//
+//	cbor.Dump(os.Stdout, os.Stdin)
+package cbor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Decoder reads the records of a CBOR log stream.
+type Decoder struct {
+	r *bufio.Reader
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Decode returns the next record of the stream, or io.EOF at the end of it.
+func (d *Decoder) Decode() (map[string]interface{}, error) {
+	v, err := d.value()
+	if err != nil {
+		return nil, err
+	}
+	record, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cbor: record is a %T, not a map", v)
+	}
+	return record, nil
+}
+
+// Dump writes the records of r to w as JSON lines.
+func Dump(w io.Writer, r io.Reader) error {
+	dec := NewDecoder(r)
+	enc := json.NewEncoder(w)
+	for {
+		record, err := dec.Decode()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := enc.Encode(record); err != nil {
+			return err
+		}
+	}
+}
+
+var errTruncated = errors.New("cbor: truncated record")
+
+// maxPrealloc bounds the room allocated ahead for the strings, arrays and
+// maps, whose length is read from the input and may be bogus: beyond it, they
+// grow as their contents are actually read.
+const maxPrealloc = 1024
+
+func (d *Decoder) value() (interface{}, error) {
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	major, info := c>>5, c&0x1f
+	if major == 7 {
+		return d.simple(info)
+	}
+	n, err := d.arg(info)
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case 0:
+		if n > math.MaxInt64 {
+			return n, nil
+		}
+		return int64(n), nil
+	case 1:
+		if n > math.MaxInt64 {
+			return nil, fmt.Errorf("cbor: negative integer overflow")
+		}
+		return -1 - int64(n), nil
+	case 2:
+		return d.bytes(n)
+	case 3:
+		b, err := d.bytes(n)
+		return string(b), err
+	case 4:
+		return d.array(n)
+	case 5:
+		return d.m(n)
+	}
+	// Tags are skipped, the tagged value is returned.
+	return d.value()
+}
+
+// arg reads the argument of a data item with the additional info.
+func (d *Decoder) arg(info byte) (uint64, error) {
+	switch {
+	case info < 24:
+		return uint64(info), nil
+	case info <= 27:
+		return d.uint(1 << (info - 24))
+	}
+	return 0, fmt.Errorf("cbor: unsupported additional info %d", info)
+}
+
+func (d *Decoder) simple(info byte) (interface{}, error) {
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		n, err := d.uint(2)
+		return halfFloat(uint16(n)), err
+	case 26:
+		n, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(n))), err
+	case 27:
+		n, err := d.uint(8)
+		return math.Float64frombits(n), err
+	}
+	return nil, fmt.Errorf("cbor: unsupported simple value %d", info)
+}
+
+func (d *Decoder) uint(size int) (uint64, error) {
+	buf := make([]byte, 8)
+	if _, err := io.ReadFull(d.r, buf[8-size:]); err != nil {
+		return 0, errTruncated
+	}
+	return binary.BigEndian.Uint64(buf), nil
+}
+
+func (d *Decoder) bytes(n uint64) ([]byte, error) {
+	if n > math.MaxInt64 {
+		return nil, errTruncated
+	}
+	var buf bytes.Buffer
+	buf.Grow(prealloc(n))
+	if _, err := io.CopyN(&buf, d.r, int64(n)); err != nil {
+		return nil, errTruncated
+	}
+	return buf.Bytes(), nil
+}
+
+func (d *Decoder) array(n uint64) ([]interface{}, error) {
+	a := make([]interface{}, 0, prealloc(n))
+	for i := uint64(0); i < n; i++ {
+		v, err := d.value()
+		if err != nil {
+			return nil, truncated(err)
+		}
+		a = append(a, v)
+	}
+	return a, nil
+}
+
+func (d *Decoder) m(n uint64) (map[string]interface{}, error) {
+	m := make(map[string]interface{}, prealloc(n))
+	for i := uint64(0); i < n; i++ {
+		k, err := d.value()
+		if err != nil {
+			return nil, truncated(err)
+		}
+		v, err := d.value()
+		if err != nil {
+			return nil, truncated(err)
+		}
+		m[fmt.Sprint(k)] = v
+	}
+	return m, nil
+}
+
+// prealloc returns the room to allocate ahead for n elements.
+func prealloc(n uint64) int {
+	if n > maxPrealloc {
+		return maxPrealloc
+	}
+	return int(n)
+}
+
+// halfFloat decodes an IEEE 754 half-precision float.
+func halfFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var v float64
+	switch exp {
+	case 0:
+		v = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			v = math.Inf(1)
+		} else {
+			v = math.NaN()
+		}
+	default:
+		v = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -v
+	}
+	return v
+}
+
+// truncated turns an EOF in the middle of a record into errTruncated.
+func truncated(err error) error {
+	if err == io.EOF {
+		return errTruncated
+	}
+	return err
+}
@@ -0,0 +1,35 @@
+package lg
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+)
+
+// DepthHeader and CallingServiceHeader are the headers of the internal
+// requests carrying the depth of the request in the call chain, and the name
+// of the service making it. They're logged as req_depth and calling_service,
+// and set by Transport on the outbound requests when it has a ServiceName.
+var (
+	DepthHeader          = "X-Request-Depth"
+	CallingServiceHeader = "X-Calling-Service"
+)
+
+// requestDepth returns the depth of r in the call chain, 0 for requests not
+// made by another service.
+func requestDepth(r *http.Request) int {
+	depth, err := strconv.Atoi(r.Header.Get(DepthHeader))
+	if err != nil || depth < 0 {
+		return 0
+	}
+	return depth
+}
+
+// outboundDepth returns the depth of the outbound requests made while serving
+// the request of ctx.
+func outboundDepth(ctx context.Context) int {
+	if entry, ok := GetLogEntry(ctx); ok && entry.req != nil {
+		return requestDepth(entry.req) + 1
+	}
+	return 1
+}
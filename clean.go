@@ -0,0 +1,35 @@
+package lg
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// cleanString escapes the control characters of s, such as newlines, and
+// replaces its invalid UTF-8 sequences, so that values coming from the client
+// (headers, uri) or from panics can't inject fake log lines into text logs, or
+// break the encoders of the log pipeline.
+func cleanString(s string) string {
+	clean := true
+	for _, c := range s {
+		if c == utf8.RuneError || unicode.IsControl(c) {
+			clean = false
+			break
+		}
+	}
+	if clean {
+		return s
+	}
+
+	var b strings.Builder
+	for _, c := range strings.ToValidUTF8(s, string(utf8.RuneError)) {
+		if unicode.IsControl(c) {
+			fmt.Fprintf(&b, "\\x%02x", c)
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
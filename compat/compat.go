@@ -0,0 +1,41 @@
+// Package compat keeps the request ids of the applications still using the
+// RequestID middleware of the github.com/go-chi/chi import path, before its
+// v5 module, in the req_id field of lg, which reads the request ids of
+// github.com/go-chi/chi/v5:
+//
+//	r.Use(middleware.RequestID)
+//	r.Use(compat.RequestLogger(logger))
+package compat
+
+import (
+	"context"
+	"net/http"
+
+	oldmiddleware "github.com/go-chi/chi/middleware"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/pressly/lg"
+	"github.com/sirupsen/logrus"
+)
+
+// RequestLogger is the same as lg.RequestLogger, with the request ids of the
+// old chi middleware carried over, see RequestID.
+func RequestLogger(logger *logrus.Logger, opts ...lg.Option) func(next http.Handler) http.Handler {
+	requestLogger := lg.RequestLogger(logger, opts...)
+	return func(next http.Handler) http.Handler {
+		return RequestID(requestLogger(next))
+	}
+}
+
+// RequestID sets the request id of the old chi middleware on the requests
+// for the middlewares of chi v5 and lg, unless they already have one. It
+// must be mounted after the RequestID middleware of the old chi, and before
+// the request logger.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if reqID := oldmiddleware.GetReqID(ctx); reqID != "" && middleware.GetReqID(ctx) == "" {
+			r = r.WithContext(context.WithValue(ctx, middleware.RequestIDKey, reqID))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
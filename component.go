@@ -0,0 +1,135 @@
+package lg
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ComponentKey is the field holding the name of the component of a logger
+// created by Component or Named.
+var ComponentKey = "component"
+
+// components holds the level overrides of the components, and the loggers
+// backing the component loggers. A component logger shares the output,
+// formatter and hooks of its parent logger, but has its own level. The
+// loggers are never removed, for SetComponentLevel to reach them, so they keep
+// their parent for the life of the process.
+var components = struct {
+	sync.Mutex
+	levels  map[string]logrus.Level
+	loggers map[componentKey]*logrus.Logger
+}{
+	levels:  map[string]logrus.Level{},
+	loggers: map[componentKey]*logrus.Logger{},
+}
+
+type componentKey struct {
+	parent *logrus.Logger
+	name   string
+}
+
+// Component returns a child logger of logger for the named component, such as
+// "db" or "cache". Its lines carry a component field, and its level can be
+// changed at runtime with SetComponentLevel, so one subsystem can be debugged
+// without enabling debug globally. The output of logger is wrapped to
+// serialize its writes with the component loggers, which are kept for the
+// life of the process, with logger.
+func Component(logger *logrus.Logger, name string) logrus.FieldLogger {
+	lockOutput(logger)
+	return logrus.NewEntry(componentLogger(logger, name)).WithField(ComponentKey, name)
+}
+
+// Named is the same as Component, for the logger of the context. The child
+// logger inherits the fields of the request entry.
+func Named(ctx context.Context, name string) logrus.FieldLogger {
+	switch l := contextLogger(ctx).(type) {
+	case *logrus.Entry:
+		entry := l.WithField(ComponentKey, name)
+		entry.Logger = componentLogger(l.Logger, name)
+		return withCaller(entry, 1)
+	case *logrus.Logger:
+		return withCaller(Component(l, name), 1)
+	default:
+		return withCaller(l.WithField(ComponentKey, name), 1)
+	}
+}
+
+// SetComponentLevel overrides the level of the loggers of a component.
+func SetComponentLevel(name string, level logrus.Level) {
+	components.Lock()
+	defer components.Unlock()
+	components.levels[name] = level
+	for key, logger := range components.loggers {
+		if key.name == name {
+			logger.SetLevel(level)
+		}
+	}
+}
+
+// SetLevel is the same as SetComponentLevel.
+func SetLevel(name string, level logrus.Level) {
+	SetComponentLevel(name, level)
+}
+
+// Levels returns the effective levels of the components with a logger or a
+// level override.
+func Levels() map[string]logrus.Level {
+	components.Lock()
+	defer components.Unlock()
+	levels := make(map[string]logrus.Level, len(components.levels))
+	for key, logger := range components.loggers {
+		levels[key.name] = loggerLevel(logger)
+	}
+	for name, level := range components.levels {
+		levels[name] = level
+	}
+	return levels
+}
+
+// ResetComponentLevel removes the level override of a component, its loggers
+// follow the level of their parent logger again.
+func ResetComponentLevel(name string) {
+	components.Lock()
+	defer components.Unlock()
+	delete(components.levels, name)
+	for key, logger := range components.loggers {
+		if key.name == name {
+			logger.SetLevel(loggerLevel(key.parent))
+		}
+	}
+}
+
+// componentLogger returns the logger backing the component loggers of parent
+// with the given name, with the level of the component.
+func componentLogger(parent *logrus.Logger, name string) *logrus.Logger {
+	components.Lock()
+	defer components.Unlock()
+
+	key := componentKey{parent, name}
+	logger, ok := components.loggers[key]
+	if !ok {
+		hooks := logrus.LevelHooks{}
+		hooks.Add(parentHooks{parent})
+		logger = &logrus.Logger{
+			Out:       sharedOutput(parent),
+			Formatter: parentFormatter{parent},
+			Hooks:     hooks,
+		}
+		components.loggers[key] = logger
+	}
+	level, ok := components.levels[name]
+	if !ok {
+		level = loggerLevel(parent)
+	}
+	logger.SetLevel(level)
+	return logger
+}
+
+// loggerLevel reads the level of logger, which may be changed concurrently
+// with SetLevel.
+func loggerLevel(logger *logrus.Logger) logrus.Level {
+	return logrus.Level(atomic.LoadUint32((*uint32)(&logger.Level)))
+}
@@ -0,0 +1,488 @@
+package lg
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/sirupsen/logrus"
+)
+
+// Config is the configuration of the logger and the request logger which can
+// be set by operators, without code changes.
+type Config struct {
+	Level          string   `json:"level" yaml:"level"`
+	Format         string   `json:"format" yaml:"format"`
+	SampleRate     float64  `json:"sample_rate" yaml:"sample_rate"`
+	SkipPaths      []string `json:"skip_paths" yaml:"skip_paths"`
+	RequestID      bool     `json:"request_id" yaml:"request_id"`
+	RedactSecrets  bool     `json:"redact_secrets" yaml:"redact_secrets"`
+	MaxFieldLength int      `json:"max_field_length" yaml:"max_field_length"`
+	MaxEntrySize   int      `json:"max_entry_size" yaml:"max_entry_size"`
+
+	SanitizeRules map[string]string `json:"sanitize_rules" yaml:"sanitize_rules"`
+}
+
+// RequestLoggerConfig holds the optional settings of the request logger
+// middleware. The zero value behaves the same as RequestLogger.
+type RequestLoggerConfig struct {
+	// RequestID makes the middleware generate a request id with chi's
+	// middleware.RequestID for requests which don't carry one yet, so that
+	// req_id is logged even if the RequestID middleware was not installed, or
+	// was installed after the request logger.
+	RequestID bool
+
+	// SanitizeRules replaces the values of the given query parameters in the
+	// logged uri, the same as the rules of SanitizingRequestLogger.
+	SanitizeRules map[string]string
+
+	// SkipPaths are the request paths, such as health checks, for which only
+	// warnings and errors are logged.
+	SkipPaths []string
+
+	// SkipMethods are the request methods, such as OPTIONS or HEAD, for which
+	// only warnings and errors are logged, and DemoteMethods the methods for
+	// which info lines are written at the debug level.
+	SkipMethods   []string
+	DemoteMethods []string
+
+	// SkipExtensions and DemoteExtensions are the same as SkipMethods and
+	// DemoteMethods, for the file extensions of the request paths, such as
+	// ".css", ".js" or ".png", to separate the static assets from the
+	// application traffic.
+	SkipExtensions   []string
+	DemoteExtensions []string
+
+	// SkipPreflight skips the successful CORS preflight requests, which can
+	// generate as much log volume as the real traffic of browser-heavy APIs.
+	SkipPreflight bool
+
+	// SampleRate is the fraction, between 0 and 1, of the requests for which
+	// the info and debug lines are logged. Warnings, errors and 5xx responses
+	// are always logged. Zero disables sampling. The decision is derived from
+	// the request id, so it's the same for all the lines of a request and for
+	// all the services sharing the id. The ids sent by the clients in the
+	// X-Request-Id header are only used with TrustRequestID, as the clients
+	// could otherwise pick ids which are always sampled out.
+	SampleRate float64
+
+	// TrustRequestID derives the sampling decision from the request ids
+	// received in the X-Request-Id header, when it's set by trusted proxies
+	// or upstream services, see SampleRate.
+	TrustRequestID bool
+
+	// Sampler adapts the sampling rate to the request rate, see
+	// AdaptiveSampler. It applies on top of SampleRate.
+	Sampler *AdaptiveSampler
+
+	// Bots detects the requests of bots and crawlers, to tag, sample or skip
+	// them, see BotDetector.
+	Bots *BotDetector
+
+	// SubtaskRollup lists the subtasks of the request started with Sub, and
+	// the fields set on them, under subtasks on the completion line.
+	SubtaskRollup bool
+
+	// StartEndTimestamps adds the ts_start and ts_end fields, in RFC3339Nano,
+	// to the completion lines, so the start of a request can be reconstructed
+	// by the log systems which aggregate by the time of the line.
+	StartEndTimestamps bool
+
+	// TrackInFlight keeps track of the requests in flight, so that
+	// LogAbortedRequests can log the requests still running when the server
+	// stops.
+	TrackInFlight bool
+
+	// StartedLineDelay delays the "request started" line of the requests,
+	// which is only written for the requests still running after the delay,
+	// or when FlushStarted is called. The quick requests are only logged by
+	// their completion line, while the started line of the long requests
+	// still shows them before they complete.
+	StartedLineDelay time.Duration
+
+	// SlowThreshold flags the requests taking longer than it with a "slow"
+	// field, and writes them at least at the warning level.
+	SlowThreshold time.Duration
+
+	// LatencyBaseline flags the requests much slower than the usual latency
+	// of their route, see LatencyBaseline.
+	LatencyBaseline *LatencyBaseline
+
+	// LevelForStatus returns the level of the completion line for a response
+	// status, such as warning for 4xx and error for 5xx. By default requests
+	// are logged at the info level.
+	LevelForStatus func(status int) logrus.Level
+
+	// StatusPolicies sets the level of the completion lines of some response
+	// statuses apart from LevelForStatus, or skips them, or counts them to be
+	// written periodically instead, such as for the 404 and 405 responses to
+	// scanners, see StatusPolicy. A level set with SetLevel takes precedence.
+	StatusPolicies map[int]StatusPolicy
+
+	// ResponseHeaders captures the given response headers on the completion
+	// line, named after the header with the resp_ prefix, such as
+	// resp_location, to debug the behavior visible to the clients. A name
+	// ending with a "*" captures the headers starting with it, such as
+	// X-RateLimit-*.
+	ResponseHeaders []string
+
+	// CacheHeaders captures the caching related response headers (see
+	// cacheHeaders) on the completion line, and flags 304 responses with
+	// not_modified=true, for cache hit-rate analysis from the access logs.
+	CacheHeaders bool
+
+	// RangeFields logs the first byte range of the Range requests as
+	// range_start and range_end, and whether a 206 Partial Content was served
+	// as range_partial, to analyze the traffic of file and media endpoints.
+	RangeFields bool
+
+	// ContentHeaders captures the Content-Type and Content-Encoding response
+	// headers on the completion line, as resp_content_type and
+	// resp_content_encoding, to debug content negotiation and compression.
+	ContentHeaders bool
+
+	// MultipartParts logs the parts of the multipart/form-data requests read
+	// by the handler as req_multipart_parts, with the name, file name and
+	// size of each part, but never their contents.
+	MultipartParts bool
+
+	// RequestBytes logs the number of bytes read from the request body by
+	// the handler as req_bytes, which is accurate for chunked uploads
+	// without Content-Length, and UploadProgressInterval also logs the
+	// progress of the uploads (req_bytes_received and upload_elapsed_ms) at
+	// that interval, while the body is read.
+	RequestBytes           bool
+	UploadProgressInterval time.Duration
+
+	// InformationalResponses passes the 1xx informational responses of the
+	// handlers, such as 103 Early Hints, through to the client and logs their
+	// statuses as informational_responses. It wraps the response writer once
+	// more, to keep the final status of the response.
+	InformationalResponses bool
+
+	// FieldProvenance is a debug mode which records the function, file and
+	// line setting each field of the request entry, such as with
+	// SetEntryField, under fields_set_by on the completion line, to find out
+	// which middleware set a wrong value. It walks the stack on every field
+	// set, so it's not meant for production.
+	FieldProvenance bool
+
+	// StatusAssertions is a debug mode which logs a warning, with the route of
+	// the request, when the handler writes no response, writes its body
+	// without a status (an implicit 200), or writes a status after the
+	// response header was written.
+	StatusAssertions bool
+
+	// WriteErrors records the first error writing the response body as
+	// write_err on the completion line, with write_err_client set when it's
+	// caused by the client going away, such as a broken pipe or a reset
+	// connection. The other write errors are logged at the error level.
+	WriteErrors bool
+
+	// ServerTiming sets the Server-Timing header of the responses, with the
+	// spans of the request ended with StartSpan and the total duration of the
+	// request so far, so clients see the timings of the logs.
+	ServerTiming bool
+
+	// TrailerFields are the response trailers, such as Grpc-Status, logged
+	// on the completion line, named after the trailer, like
+	// resp_trailer_grpc_status.
+	TrailerFields []string
+
+	// DurationBuckets are the ascending boundaries of the latency buckets of
+	// the resp_elapsed_bucket field, such as "<10ms", "10ms-100ms" or ">1s",
+	// for log systems which can't compute numeric percentiles cheaply.
+	DurationBuckets []time.Duration
+
+	// ContextFields are the values of the request context logged on the
+	// completion line, see ContextField and CaptureContext.
+	ContextFields []ContextField
+
+	// OperationID resolves the OpenAPI operationId of a request, logged as
+	// operation_id on the completion line, to align the access logs with the
+	// API documentation. See OperationIDs.
+	OperationID func(r *http.Request) string
+
+	// BodyKeys logs the top-level keys of the JSON request bodies read by the
+	// handler as req_body_keys on the completion line, without their values,
+	// to see the shape of the payloads sent by clients. Only the first 64KB
+	// of a body are inspected.
+	BodyKeys bool
+
+	// IsError classifies the requests as errors or not against the SLO of the
+	// service, logged as slo_error on the completion line, so that error
+	// budgets can be computed from the access logs. err is the recovered
+	// panic of the request, if any.
+	IsError func(status int, r *http.Request, err error) bool
+
+	// GoroutineDiagnostics logs the id of the goroutine serving the request as
+	// goroutine_id, and the number of goroutines at the start and end of the
+	// request as num_goroutine, to match stuck requests with goroutine dumps.
+	// It's meant for debugging, reading the goroutine id isn't free.
+	GoroutineDiagnostics bool
+
+	// Security detects suspicious requests and writes security events for
+	// them, see SecurityDetector.
+	Security *SecurityDetector
+
+	// OnComplete is called after the request entry has been written, with the
+	// final response status, bytes written, elapsed time and the fields of the
+	// entry, rewritten as for its lines, such as by RedactSecrets. It's useful to record custom metrics or SLO counters without
+	// having to add a second timing middleware.
+	OnComplete func(r *http.Request, status, bytes int, elapsed time.Duration, fields logrus.Fields)
+
+	// InterceptFatal turns the fatal lines logged with the logger of a
+	// request into errors aborting the request with a 500, flagged with
+	// fatal_intercepted=true, instead of exiting the process in the middle
+	// of the request. Hooks added to the logger after the start of a request
+	// don't apply to its lines.
+	InterceptFatal bool
+
+	// Repanic makes the request logger record the panics on the entry and
+	// write it, then panic again instead of recovering, for a Recoverer
+	// installed before the request logger.
+	Repanic bool
+
+	// MaxPanicsPerMinute crashes the process, after logging the request,
+	// once more than that many panics have been recovered within a minute,
+	// instead of recovering forever from a broken state. Zero disables it.
+	// The handlers registered with logrus.RegisterExitHandler run before
+	// exiting, to flush the buffered writers, such as with Setup.
+	MaxPanicsPerMinute int
+
+	// DumpDir is the directory where the requests which failed with a 5xx
+	// or a panic are dumped, in the HTTP/1.1 wire format, as <req_id>.http,
+	// to be replayed locally with the replay package. The first
+	// DumpBodyLimit bytes (64KB when zero) of the request body read by the
+	// handler are kept. The credential headers, such as Authorization,
+	// Cookie or X-Api-Key, are left out, and the secrets are masked with
+	// RedactSecrets. The dumps are written in the background, and a dump
+	// never replaces another one: the next dumps of a request id are named
+	// <req_id>-<n>.http. The directory and the dumps are only readable by the
+	// user of the process.
+	DumpDir       string
+	DumpBodyLimit int
+
+	// OnServerError is called after the completion line of the requests
+	// ending with a 5xx status or a panic, to page or trip a breaker in simple
+	// deployments without a metrics stack.
+	OnServerError func(entry *HTTPLoggerEntry, status int)
+
+	// BeforeWrite is a chain of hooks run in order before any line of the
+	// request entry is written (request started, request complete, panics,
+	// and the lines logged through Log(ctx), Transport or a subtask of the
+	// request), for enrichment, redaction or dropping of fields in one place.
+	// As the field policy, secrets redaction and size limits below, they run
+	// before the logrus hooks of the logger.
+	BeforeWrite []BeforeWriteFunc
+
+	// Filter is called with the level, message and fields of every line about
+	// to be written by the request logger, after the BeforeWrite hooks. Lines
+	// for which it returns false are dropped, so noisy known messages can be
+	// discarded in one place instead of downstream.
+	Filter func(level logrus.Level, msg string, fields logrus.Fields) bool
+
+	// MaxFieldLength truncates the values of the fields longer than it, and
+	// MaxEntrySize truncates the largest fields until the total size of the
+	// fields fits, so that an accidental huge field can't blow up the log
+	// pipeline. The keys of truncated fields are listed in "_truncated".
+	// Zero means no limit.
+	MaxFieldLength int
+	MaxEntrySize   int
+
+	// RedactSecrets masks the values matching SecretPatterns (tokens, JWTs,
+	// AWS keys, credit card numbers) in every field, as a safety net beyond
+	// the key based rules of SanitizingRequestLogger. The keys of the masked
+	// fields are listed in "redacted_fields".
+	RedactSecrets bool
+
+	// FieldTags tags field keys, such as "email" as TagPII, and FieldPolicy
+	// decides whether the tagged fields are emitted, hashed or dropped. Use
+	// DevPolicy, StagingPolicy or ProdPolicy to log richly in development and
+	// safely in production from the same code.
+	FieldTags   map[string]FieldTag
+	FieldPolicy FieldPolicy
+
+	watcher *ConfigWatcher
+}
+
+// cacheHeaders are the response headers captured with CacheHeaders.
+var cacheHeaders = []string{"Cache-Control", "ETag", "Age", "X-Cache", "CF-Ray", "CF-Cache-Status"}
+
+// rateLimitHeaders are the response headers captured on the 429 responses.
+var rateLimitHeaders = []string{"Retry-After", "X-RateLimit-*", "RateLimit-*"}
+
+// contentHeaders are the response headers captured with ContentHeaders.
+var contentHeaders = []string{"Content-Type", "Content-Encoding"}
+
+// durationBucket returns the label of the bucket of d among the ascending
+// boundaries of buckets.
+func durationBucket(d time.Duration, buckets []time.Duration) string {
+	for i, b := range buckets {
+		if d < b {
+			if i == 0 {
+				return "<" + b.String()
+			}
+			return buckets[i-1].String() + "-" + b.String()
+		}
+	}
+	return ">" + buckets[len(buckets)-1].String()
+}
+
+// emptyConfig is the config of the middlewares which don't take settings.
+var emptyConfig RequestLoggerConfig
+
+// quiet reports whether the info and debug lines of the request are dropped,
+// because its path or method is skipped, it's a skipped CORS preflight, or
+// it's sampled out.
+func (c *RequestLoggerConfig) quiet(r *http.Request) bool {
+	for _, p := range c.SkipPaths {
+		if r.URL.Path == p {
+			return true
+		}
+	}
+	for _, m := range c.SkipMethods {
+		if r.Method == m {
+			return true
+		}
+	}
+	if hasExtension(r, c.SkipExtensions) {
+		return true
+	}
+	if c.SkipPreflight && isPreflight(r) {
+		return true
+	}
+	// The adaptive sampler counts every request to measure the request rate
+	u := sampleValue(r, c.TrustRequestID)
+	sampledOut := c.Sampler != nil && !c.Sampler.keep(u)
+	if !sampledOut && c.SampleRate > 0 && c.SampleRate < 1 {
+		sampledOut = u >= c.SampleRate
+	}
+	if sampledOut {
+		atomic.AddUint64(&counters.SampledOut, 1)
+	}
+	return sampledOut
+}
+
+// sampleValue returns the value, between 0 and 1, compared to the sampling
+// rates to decide whether a request is sampled out. It's derived from the
+// request id when there is one, from the top 53 bits of the FNV-1a 64 bits
+// hash of the id, so that every service sharing the id, and sampling at the
+// same rate, makes the same decision. Otherwise, or when the id comes from
+// the request header and trusted is false, it's random.
+func sampleValue(r *http.Request, trusted bool) float64 {
+	reqID := middleware.GetReqID(r.Context())
+	if reqID == "" || !trusted && r.Header.Get(middleware.RequestIDHeader) != "" {
+		return rand.Float64()
+	}
+	h := fnv.New64a()
+	h.Write([]byte(reqID))
+	return float64(h.Sum64()>>11) / (1 << 53)
+}
+
+// demoted reports whether the info lines of the request are written at the
+// debug level.
+func (c *RequestLoggerConfig) demoted(r *http.Request) bool {
+	for _, m := range c.DemoteMethods {
+		if r.Method == m {
+			return true
+		}
+	}
+	return hasExtension(r, c.DemoteExtensions)
+}
+
+// hasExtension reports whether the path of r has one of the file extensions,
+// given with or without the leading dot, in any case.
+func hasExtension(r *http.Request, extensions []string) bool {
+	if len(extensions) == 0 {
+		return false
+	}
+	ext := strings.TrimPrefix(path.Ext(r.URL.Path), ".")
+	if ext == "" {
+		return false
+	}
+	for _, e := range extensions {
+		if strings.EqualFold(ext, strings.TrimPrefix(e, ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPreflight reports whether r is a CORS preflight request.
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Origin") != "" &&
+		r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// rewritesFields reports whether the fields of an entry must be processed
+// before being written.
+func (c *RequestLoggerConfig) rewritesFields() bool {
+	return len(c.BeforeWrite) > 0 || c.FieldPolicy != nil || c.RedactSecrets || c.MaxFieldLength > 0 || c.MaxEntrySize > 0
+}
+
+// BeforeWriteFunc receives the fields of a request entry right before a line
+// is written and returns the fields to write. It may add, modify or remove
+// fields, and can safely modify the given map which is a copy.
+type BeforeWriteFunc func(entry *HTTPLoggerEntry, fields logrus.Fields) logrus.Fields
+
+// Apply sets the level and formatter of the logger, when configured.
+func (c Config) Apply(logger *logrus.Logger) error {
+	if c.Level != "" {
+		level, err := logrus.ParseLevel(c.Level)
+		if err != nil {
+			return fmt.Errorf("lg: invalid level %q: %v", c.Level, err)
+		}
+		logger.SetLevel(level)
+	}
+	if c.Format != "" {
+		formatter := NewFormatter(c.Format)
+		if formatter == nil {
+			return fmt.Errorf("lg: unknown format %q", c.Format)
+		}
+		logger.Formatter = formatter
+	}
+	return nil
+}
+
+// RequestLoggerConfig returns the request logger settings of the config.
+func (c Config) RequestLoggerConfig() RequestLoggerConfig {
+	return c.merge(RequestLoggerConfig{})
+}
+
+// current returns the settings of c, with the settings of the config file of
+// its ConfigWatcher applied on top.
+func (c *RequestLoggerConfig) current() *RequestLoggerConfig {
+	if c.watcher == nil {
+		return c
+	}
+	return c.watcher.merged(c)
+}
+
+// merge overrides the settings of base which are set by the config.
+func (c Config) merge(base RequestLoggerConfig) RequestLoggerConfig {
+	base.RequestID = base.RequestID || c.RequestID
+	base.RedactSecrets = base.RedactSecrets || c.RedactSecrets
+	if c.SkipPaths != nil {
+		base.SkipPaths = c.SkipPaths
+	}
+	if c.SampleRate != 0 {
+		base.SampleRate = c.SampleRate
+	}
+	if c.MaxFieldLength != 0 {
+		base.MaxFieldLength = c.MaxFieldLength
+	}
+	if c.MaxEntrySize != 0 {
+		base.MaxEntrySize = c.MaxEntrySize
+	}
+	if c.SanitizeRules != nil {
+		base.SanitizeRules = c.SanitizeRules
+	}
+	return base
+}
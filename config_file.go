@@ -0,0 +1,165 @@
+package lg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// LoadConfig reads a YAML config file, when its extension is .yaml or .yml,
+// or a JSON one, such as:
+//
+//	{"level": "debug", "format": "json", "sample_rate": 0.1,
+//	 "skip_paths": ["/ping"], "sanitize_rules": {"token": "[redacted]"}}
+func LoadConfig(path string) (Config, error) {
+	var c Config
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return c, fmt.Errorf("lg: reading config: %v", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &c)
+	default:
+		err = json.Unmarshal(data, &c)
+	}
+	if err != nil {
+		return c, fmt.Errorf("lg: parsing config %s: %v", path, err)
+	}
+	return c, nil
+}
+
+// ConfigWatcher keeps a config file loaded and reloads it when it changes.
+// Pass it to the request logger with WithConfigWatcher to adjust the logging
+// of a running service.
+type ConfigWatcher struct {
+	path    string
+	logger  *logrus.Logger
+	config  atomic.Value // *Config
+	modTime time.Time
+	size    int64
+
+	// merges holds the request logger settings merged with the last loaded
+	// config, per request logger, so they're merged once per reload.
+	merges sync.Map // *RequestLoggerConfig -> *mergedConfig
+}
+
+type mergedConfig struct {
+	loaded *Config
+	config *RequestLoggerConfig
+}
+
+// WatchConfig loads the config file at path and applies it to logger, then
+// watches the file with fsnotify until ctx is done. On change, the level of
+// the logger and the request logger settings are reloaded. The format is
+// only applied on the first load, as the formatter of a logger in use can't
+// be replaced safely. Reload errors are logged to logger and the previous
+// config is kept. The directory of the file is watched, so that the file
+// is still seen when it's replaced, such as by editors or by the updates of
+// a Kubernetes ConfigMap.
+func WatchConfig(ctx context.Context, path string, logger *logrus.Logger) (*ConfigWatcher, error) {
+	w := &ConfigWatcher{path: path, logger: logger}
+	c, err := w.load()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Apply(logger); err != nil {
+		return nil, err
+	}
+	w.config.Store(&c)
+
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("lg: watching config: %v", err)
+	}
+	if err := fw.Add(filepath.Dir(path)); err != nil {
+		fw.Close()
+		return nil, fmt.Errorf("lg: watching config: %v", err)
+	}
+	go w.watch(ctx, fw)
+	return w, nil
+}
+
+func (w *ConfigWatcher) watch(ctx context.Context, fw *fsnotify.Watcher) {
+	defer fw.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-fw.Events:
+			if !ok {
+				return
+			}
+			// The other files of the directory are skipped by reload, as
+			// the config file is unchanged.
+			w.reload()
+		case err, ok := <-fw.Errors:
+			if !ok {
+				return
+			}
+			w.logger.WithError(err).Errorln("lg: config watch failed")
+		}
+	}
+}
+
+// Config returns the last loaded config.
+func (w *ConfigWatcher) Config() Config {
+	return *w.loaded()
+}
+
+func (w *ConfigWatcher) loaded() *Config {
+	return w.config.Load().(*Config)
+}
+
+// merged returns the settings of base with the last loaded config applied.
+func (w *ConfigWatcher) merged(base *RequestLoggerConfig) *RequestLoggerConfig {
+	loaded := w.loaded()
+	if m, ok := w.merges.Load(base); ok && m.(*mergedConfig).loaded == loaded {
+		return m.(*mergedConfig).config
+	}
+	c := loaded.merge(*base)
+	w.merges.Store(base, &mergedConfig{loaded: loaded, config: &c})
+	return &c
+}
+
+func (w *ConfigWatcher) load() (Config, error) {
+	fi, err := os.Stat(w.path)
+	if err != nil {
+		return Config{}, fmt.Errorf("lg: reading config: %v", err)
+	}
+	c, err := LoadConfig(w.path)
+	if err != nil {
+		return c, err
+	}
+	w.modTime, w.size = fi.ModTime(), fi.Size()
+	return c, nil
+}
+
+func (w *ConfigWatcher) reload() {
+	fi, err := os.Stat(w.path)
+	if err != nil || (fi.ModTime().Equal(w.modTime) && fi.Size() == w.size) {
+		return
+	}
+	c, err := w.load()
+	if err == nil {
+		level := Config{Level: c.Level}
+		err = level.Apply(w.logger)
+	}
+	if err != nil {
+		w.logger.WithError(err).Errorln("lg: config reload failed")
+		return
+	}
+	w.config.Store(&c)
+	w.logger.WithField("config", w.path).Infoln("lg: config reloaded")
+}
@@ -0,0 +1,45 @@
+package lg
+
+import (
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ConnStateLogger returns a hook for http.Server.ConnState logging the state
+// transitions of the connections at the debug level, with the remote address
+// and the number of connections in each state, to diagnose connection leaks
+// and keep-alive behaviour:
+//
+//	srv := &http.Server{ConnState: lg.ConnStateLogger(logger)}
+func ConnStateLogger(logger *logrus.Logger) func(net.Conn, http.ConnState) {
+	var mu sync.Mutex
+	conns := map[net.Conn]http.ConnState{}
+	counts := map[http.ConnState]int{}
+
+	return func(conn net.Conn, state http.ConnState) {
+		mu.Lock()
+		if prev, ok := conns[conn]; ok {
+			counts[prev]--
+		}
+		if state == http.StateHijacked || state == http.StateClosed {
+			delete(conns, conn)
+		} else {
+			conns[conn] = state
+			counts[state]++
+		}
+		fields := logrus.Fields{
+			"remote_addr":  conn.RemoteAddr().String(),
+			"conn_state":   state.String(),
+			"conns_open":   len(conns),
+			"conns_new":    counts[http.StateNew],
+			"conns_active": counts[http.StateActive],
+			"conns_idle":   counts[http.StateIdle],
+		}
+		mu.Unlock()
+
+		logger.WithFields(fields).Debugln("connection " + state.String())
+	}
+}
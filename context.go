@@ -3,6 +3,8 @@ package lg
 import (
 	"context"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -10,40 +12,164 @@ import (
 var (
 	LoggerCtxKey   = &contextKey{"Logger"}
 	LogEntryCtxKey = &contextKey{"LogEntry"}
+
+	fieldsCtxKey = &contextKey{"Fields"}
 )
 
 func WithLoggerContext(parent context.Context, logger *logrus.Logger) context.Context {
-	return context.WithValue(parent, LoggerCtxKey, logger)
+	ctx := context.WithValue(parent, LoggerCtxKey, logger)
+	return context.WithValue(ctx, fieldsCtxKey, &contextFields{})
+}
+
+// WithEntryContext returns a context with the logger and the fields of a
+// logrus entry, for the code outside of a request, such as tests and workers.
+// Log(ctx) returns a logger with the fields of the entry, and the fields added
+// with SetEntryField, the same as for WithLoggerContext.
+func WithEntryContext(parent context.Context, entry *logrus.Entry) context.Context {
+	fields := &contextFields{}
+	if len(entry.Data) > 0 {
+		fields.set(entry.Data)
+	}
+	ctx := context.WithValue(parent, LoggerCtxKey, entry.Logger)
+	return context.WithValue(ctx, fieldsCtxKey, fields)
 }
 
 func WithLogEntry(parent context.Context, logEntry *HTTPLoggerEntry) context.Context {
 	return context.WithValue(parent, LogEntryCtxKey, logEntry)
 }
 
+// GetLogEntry returns the request entry of the context, set by the request
+// logger, so that middlewares can adjust it.
+func GetLogEntry(ctx context.Context) (*HTTPLoggerEntry, bool) {
+	entry, ok := ctx.Value(LogEntryCtxKey).(*HTTPLoggerEntry)
+	return entry, ok
+}
+
 func Log(ctx context.Context) logrus.FieldLogger {
-	if entry, ok := ctx.Value(LogEntryCtxKey).(*HTTPLoggerEntry); ok {
-		return entry.Logger
+	return withCaller(contextLogger(ctx), 1)
+}
+
+func RequestLog(r *http.Request) logrus.FieldLogger {
+	return withCaller(contextLogger(r.Context()), 1)
+}
+
+// contextLogger returns the logger of the context, with the fields of the
+// request entry or of the context.
+func contextLogger(ctx context.Context) logrus.FieldLogger {
+	if entry, ok := GetLogEntry(ctx); ok {
+		return entry.lineLogger()
 	}
 	lgr, ok := ctx.Value(LoggerCtxKey).(*logrus.Logger)
 	if !ok {
 		panic("lg: logger backend has not been set on the context.")
 	}
+	if fields, ok := ctx.Value(fieldsCtxKey).(*contextFields); ok {
+		if data := fields.get(); len(data) > 0 {
+			return lgr.WithFields(data)
+		}
+	}
 	return lgr
 }
 
-func RequestLog(r *http.Request) logrus.FieldLogger {
-	return Log(r.Context())
+// loggerOrDefault returns the logger of ctx, or DefaultLogger if it has none.
+func loggerOrDefault(ctx context.Context) logrus.FieldLogger {
+	if _, ok := GetLogEntry(ctx); ok {
+		return contextLogger(ctx)
+	}
+	if _, ok := ctx.Value(LoggerCtxKey).(*logrus.Logger); ok {
+		return contextLogger(ctx)
+	}
+	return DefaultLogger
 }
 
+// SetEntryField adds a field to the request entry of the context. Outside of
+// a request, the field is kept on the context created by WithLoggerContext and
+// is included in every line logged through Log(ctx).
 func SetEntryField(ctx context.Context, key string, value interface{}) {
-	if entry, ok := ctx.Value(LogEntryCtxKey).(*HTTPLoggerEntry); ok {
-		entry.Logger = entry.Logger.WithField(key, value)
+	if entry, ok := GetLogEntry(ctx); ok {
+		entry.AddFields(logrus.Fields{key: value})
+		return
+	}
+	if fields, ok := ctx.Value(fieldsCtxKey).(*contextFields); ok {
+		fields.set(logrus.Fields{key: value})
 	}
 }
 
+// SetEntryFields is the same as SetEntryField, for multiple fields at once.
 func SetEntryFields(ctx context.Context, fields map[string]interface{}) {
-	if entry, ok := ctx.Value(LogEntryCtxKey).(*HTTPLoggerEntry); ok {
-		entry.Logger = entry.Logger.WithFields(fields)
+	if entry, ok := GetLogEntry(ctx); ok {
+		entry.AddFields(fields)
+		return
+	}
+	if cf, ok := ctx.Value(fieldsCtxKey).(*contextFields); ok {
+		cf.set(fields)
+	}
+}
+
+// SetCompletionField adds a field to the completion line of the request of
+// the context only, such as a count of results, unlike SetEntryField whose
+// fields are also on the lines logged through Log(ctx) after it. It does
+// nothing outside of a request.
+func SetCompletionField(ctx context.Context, key string, value interface{}) {
+	if entry, ok := GetLogEntry(ctx); ok {
+		entry.addCompletionFields(logrus.Fields{key: value})
+	}
+}
+
+// GetEntryField returns the value of a field of the request entry of the
+// context, or of the fields set on a context without request entry.
+func GetEntryField(ctx context.Context, key string) (interface{}, bool) {
+	val, ok := EntryFields(ctx)[key]
+	return val, ok
+}
+
+// EntryFields returns a copy of the fields of the request entry of the
+// context, or of the fields set on a context without request entry.
+func EntryFields(ctx context.Context) logrus.Fields {
+	var data logrus.Fields
+	if entry, ok := GetLogEntry(ctx); ok {
+		data = entry.fields()
+	} else if cf, ok := ctx.Value(fieldsCtxKey).(*contextFields); ok {
+		data = cf.get()
+	}
+	fields := make(logrus.Fields, len(data))
+	for k, v := range data {
+		fields[k] = v
+	}
+	return fields
+}
+
+// SetRequestLevel changes the level of the logger of the request of the
+// context for the rest of the request, such as to debug a single request of a
+// beta user. The lines of the request below the level are dropped, and the
+// lines above it are written even if the request is skipped or sampled out.
+// Within a subtask, see Sub, the level of the request is changed too.
+func SetRequestLevel(ctx context.Context, level logrus.Level) {
+	if entry, ok := GetLogEntry(ctx); ok {
+		for ; entry != nil; entry = entry.parent {
+			entry.setLoggerLevel(level)
+		}
+	}
+}
+
+// FlushStarted writes the started line of the request of the context now,
+// when it's delayed with StartedLineDelay, such as before blocking for a long
+// time. It does nothing if the line was already written.
+func FlushStarted(ctx context.Context) {
+	if entry, ok := GetLogEntry(ctx); ok {
+		entry.writeStarted()
+	}
+}
+
+// SetBudget sets the latency budget of the request of the context, such as
+// the SLO of its endpoint. The completion line is logged with budget_ms, and
+// over_budget when the request took longer.
+func SetBudget(ctx context.Context, budget time.Duration) {
+	if entry, ok := GetLogEntry(ctx); ok {
+		entry = entry.root()
+		entry.mu.Lock()
+		entry.budget = budget
+		entry.mu.Unlock()
 	}
 }
 
@@ -55,6 +181,32 @@ func SetRequestEntryFields(r *http.Request, fields map[string]interface{}) {
 	SetEntryFields(r.Context(), fields)
 }
 
+// contextFields accumulates the fields set on a context that carries a logger
+// but no request entry, such as a server or background job context.
+type contextFields struct {
+	mu   sync.Mutex
+	data logrus.Fields
+}
+
+func (f *contextFields) set(fields logrus.Fields) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data := make(logrus.Fields, len(f.data)+len(fields))
+	for k, v := range f.data {
+		data[k] = v
+	}
+	for k, v := range fields {
+		data[k] = v
+	}
+	f.data = data
+}
+
+func (f *contextFields) get() logrus.Fields {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.data
+}
+
 // contextKey is a value for use with context.WithValue. It's used as
 // a pointer so it fits in an interface{} without allocation. This technique
 // for defining context keys was copied from Go 1.7's new use of context in net/http.
@@ -0,0 +1,72 @@
+package lg
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ContextField is a value of the request context logged on the completion
+// line, such as the auth claims or feature flags set by other middlewares,
+// without them having to call SetEntryField.
+type ContextField struct {
+	// Key is the field key.
+	Key string
+	// CtxKey is the key of the value in the context.
+	CtxKey interface{}
+	// Format, if set, returns the value to log from the value of the context,
+	// such as the subject of the claims. A nil result is not logged.
+	Format func(v interface{}) interface{}
+}
+
+// CaptureContext is a middleware recording the context of the request on its
+// entry, for the ContextFields of the request logger and the deadline fields
+// of the completion line. The values and the deadline set on the context by
+// the middlewares between the request logger and CaptureContext, such as
+// middleware.Timeout, are only visible to the request logger through it, so
+// it's usually installed right before the handlers.
+func CaptureContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if entry, ok := GetLogEntry(r.Context()); ok {
+			entry.mu.Lock()
+			entry.ctx = r.Context()
+			entry.mu.Unlock()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// contextFields returns the fields of the ContextFields of the config, read
+// from the context recorded by CaptureContext, or the context of the request.
+func (l *HTTPLoggerEntry) contextFields() logrus.Fields {
+	return extractContextFields(l.context(), l.conf().ContextFields)
+}
+
+// context returns the context recorded by CaptureContext, or the context of
+// the request, if any.
+func (l *HTTPLoggerEntry) context() context.Context {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ctx != nil {
+		return l.ctx
+	}
+	if l.req == nil {
+		return context.Background()
+	}
+	return l.req.Context()
+}
+
+func extractContextFields(ctx context.Context, cfs []ContextField) logrus.Fields {
+	fields := logrus.Fields{}
+	for _, cf := range cfs {
+		v := ctx.Value(cf.CtxKey)
+		if v != nil && cf.Format != nil {
+			v = cf.Format(v)
+		}
+		if v != nil {
+			fields[cf.Key] = v
+		}
+	}
+	return fields
+}
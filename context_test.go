@@ -0,0 +1,59 @@
+package lg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TestSetEntryFieldConcurrent sets fields on the request entry from the
+// goroutines of a handler while they log with it, run it with -race.
+func TestSetEntryFieldConcurrent(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &buf
+	logger.Formatter = &logrus.JSONFormatter{}
+
+	const n = 50
+	h := RequestLogger(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				ctx := r.Context()
+				SetEntryField(ctx, fmt.Sprintf("field_%d", i), i)
+				SetCompletionField(ctx, fmt.Sprintf("completion_%d", i), i)
+				Log(ctx).Debugln("working")
+				if _, ok := GetEntryField(ctx, fmt.Sprintf("field_%d", i)); !ok {
+					t.Errorf("field_%d not set", i)
+				}
+			}(i)
+		}
+		wg.Wait()
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	var complete map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &complete); err != nil {
+		t.Fatalf("parsing %q: %v", lines[len(lines)-1], err)
+	}
+	if complete["msg"] != "request complete" {
+		t.Fatalf("last line is %q, want the completion line", complete["msg"])
+	}
+	for i := 0; i < n; i++ {
+		for _, key := range []string{fmt.Sprintf("field_%d", i), fmt.Sprintf("completion_%d", i)} {
+			if complete[key] != float64(i) {
+				t.Errorf("%s = %v, want %d", key, complete[key], i)
+			}
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package lg
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// lockedWriter serializes the writes to the output of a logger and of the
+// loggers derived from it, such as to intercept the fatal lines or with
+// another level: logrus serializes the writes of a logger with its own lock
+// only. It's installed by lockOutput.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
+// lockOutput wraps the output of logger in a lockedWriter, when the request
+// logger or a component logger is created for it.
+func lockOutput(logger *logrus.Logger) {
+	if _, ok := logger.Out.(*lockedWriter); !ok {
+		logger.Out = &lockedWriter{w: logger.Out}
+	}
+}
+
+// parentOutput is the output of a derived logger, which writes to the current
+// output of its parent. It's serialized with the writes of the parent when
+// its output is locked by lockOutput, and with the other derived loggers
+// otherwise.
+type parentOutput struct {
+	parent *logrus.Logger
+	mu     *sync.Mutex
+}
+
+func (o parentOutput) Write(p []byte) (n int, err error) {
+	defer recoverLogging(&err)
+	if w, ok := o.parent.Out.(*lockedWriter); ok {
+		return w.Write(p)
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.parent.Out.Write(p)
+}
+
+// outputs holds the locks of the outputs of the parent loggers, for the
+// outputs which are not locked by lockOutput. Like the derived loggers, they
+// are kept for the life of the process, see entryLoggers.
+var outputs sync.Map
+
+// sharedOutput returns the output of the loggers derived from parent.
+func sharedOutput(parent *logrus.Logger) io.Writer {
+	mu, _ := outputs.LoadOrStore(parent, &sync.Mutex{})
+	return parentOutput{parent, mu.(*sync.Mutex)}
+}
+
+// parentFormatter formats the lines of a derived logger with the formatter of
+// its parent, as it is when the line is logged.
+type parentFormatter struct {
+	parent *logrus.Logger
+}
+
+func (f parentFormatter) Format(entry *logrus.Entry) (b []byte, err error) {
+	defer recoverLogging(&err)
+	return f.parent.Formatter.Format(entry)
+}
+
+// parentHooks fires the hooks of a parent logger, as they are when the line
+// is logged, from a derived logger.
+type parentHooks struct {
+	parent *logrus.Logger
+}
+
+func (h parentHooks) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h parentHooks) Fire(entry *logrus.Entry) (err error) {
+	defer recoverLogging(&err)
+	return h.parent.Hooks.Fire(entry.Level, entry)
+}
+
+// recoverLogging turns a panic of the hooks, formatter or output of a parent
+// logger into an error, reported by logrus to stderr, so that a line logged
+// with a derived logger never takes down its caller. The panics aborting a
+// request on an intercepted fatal line go through.
+func recoverLogging(err *error) {
+	if rec := recover(); rec != nil {
+		if _, ok := rec.(*fatalError); ok {
+			panic(rec)
+		}
+		atomic.AddUint64(&counters.PipelinePanics, 1)
+		*err = fmt.Errorf("lg: logging panicked: %v", rec)
+	}
+}
+
+// entryKey is the field marking the lines of a request entry logged outside
+// of the request logger, see HTTPLoggerEntry.lineLogger, with the entry.
+const entryKey = "lg_entry"
+
+// entryFormatter is the formatter of the loggers of the request entries. It
+// runs the lines marked with entryKey through the BeforeWrite hooks, field
+// policy, secrets redaction and size limits of their request entry, then
+// fires the hooks of the parent logger, so that they see the rewritten
+// fields, and formats the lines with the formatter of the parent. The panics
+// of the hooks and the formatter are recovered.
+type entryFormatter struct {
+	parent *logrus.Logger
+	mu     sync.Mutex // serializes the hooks
+}
+
+func (f *entryFormatter) Format(entry *logrus.Entry) (b []byte, err error) {
+	if l, ok := entry.Data[entryKey].(*HTTPLoggerEntry); ok {
+		fields := make(logrus.Fields, len(entry.Data))
+		for k, v := range entry.Data {
+			if k != entryKey {
+				fields[k] = v
+			}
+		}
+		entry.Data = fields
+		if err := f.rewrite(l, entry); err != nil {
+			fmt.Fprintf(os.Stderr, "lg: failed to rewrite fields: %v\n", err)
+		}
+	}
+	if err := f.fireHooks(entry); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to fire hook: %v\n", err)
+	}
+	defer recoverLogging(&err)
+	return f.parent.Formatter.Format(entry)
+}
+
+func (f *entryFormatter) rewrite(l *HTTPLoggerEntry, entry *logrus.Entry) (err error) {
+	defer recoverLogging(&err)
+	entry.Data = l.rewriteFields(entry.Data)
+	return nil
+}
+
+// fireHooks fires the hooks of the parent, with the parent as the logger of
+// the entry, so that the hooks formatting the entry don't come back here.
+func (f *entryFormatter) fireHooks(entry *logrus.Entry) (err error) {
+	e := *entry
+	e.Logger = f.parent
+	e.Buffer = nil
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	defer recoverLogging(&err)
+	return f.parent.Hooks.Fire(e.Level, &e)
+}
+
+// entryLoggers holds the loggers of the request entries, derived from the
+// parent loggers. The derived loggers reference their parent, so neither is
+// ever released: there's one per parent logger for the life of the process.
+// That's meant for the loggers created once at startup, as given to
+// RequestLogger; a logger created per request or per test is retained, with
+// its output, until the process exits.
+var entryLoggers sync.Map
+
+// entryLogger returns the logger of the request entries of parent, sharing
+// its output, formatter, level and hooks, and recovering their panics, see
+// entryFormatter. It's created once per parent.
+func entryLogger(parent *logrus.Logger) *logrus.Logger {
+	v, ok := entryLoggers.Load(parent)
+	if !ok {
+		v, _ = entryLoggers.LoadOrStore(parent, &logrus.Logger{
+			Out:       sharedOutput(parent),
+			Formatter: &entryFormatter{parent: parent},
+			Hooks:     logrus.LevelHooks{},
+			Level:     loggerLevel(parent),
+		})
+	}
+	logger := v.(*logrus.Logger)
+	logger.SetLevel(loggerLevel(parent))
+	return logger
+}
+
+type levelKey struct {
+	parent *logrus.Logger
+	level  logrus.Level
+}
+
+// levelLoggers holds the loggers derived from the parent loggers with another
+// level, up to one per level of each parent, retained as the entryLoggers.
+var levelLoggers sync.Map
+
+// levelLogger returns the logger sharing the output, formatter and hooks of
+// parent, with the given level. It's created once per parent and level.
+func levelLogger(parent *logrus.Logger, level logrus.Level) *logrus.Logger {
+	key := levelKey{parent, level}
+	v, ok := levelLoggers.Load(key)
+	if !ok {
+		hooks := logrus.LevelHooks{}
+		hooks.Add(parentHooks{parent})
+		v, _ = levelLoggers.LoadOrStore(key, &logrus.Logger{
+			Out:       sharedOutput(parent),
+			Formatter: parentFormatter{parent},
+			Hooks:     hooks,
+			Level:     level,
+		})
+	}
+	return v.(*logrus.Logger)
+}
@@ -0,0 +1,183 @@
+package lg
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// dumpBodyLimit is the default number of bytes of the request bodies kept
+// for the dumps, see DumpDir.
+const dumpBodyLimit = 64 << 10
+
+// dumpSecretHeaders are the substrings of the names of the request headers
+// left out of the dumps, in lower case, such as for Authorization, Cookie or
+// X-Api-Key.
+var dumpSecretHeaders = []string{"auth", "token", "secret", "password", "api-key", "apikey", "session", "cookie"}
+
+// dumpBody keeps the first bytes read from a request body, for its dump.
+type dumpBody struct {
+	io.ReadCloser
+	limit int
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func newDumpBody(body io.ReadCloser, limit int) *dumpBody {
+	if limit <= 0 {
+		limit = dumpBodyLimit
+	}
+	return &dumpBody{ReadCloser: body, limit: limit}
+}
+
+func (b *dumpBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.mu.Lock()
+	if room := b.limit - b.buf.Len(); room > 0 {
+		if n < room {
+			room = n
+		}
+		b.buf.Write(p[:room])
+	}
+	b.mu.Unlock()
+	return n, err
+}
+
+func (b *dumpBody) bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...)
+}
+
+// maxPendingDumps is the number of dumps being written in the background,
+// beyond which the dumps of the failed requests are dropped.
+const maxPendingDumps = 16
+
+// maxDumpVariants is the number of dumps kept for a request id.
+const maxDumpVariants = 100
+
+// pendingDumps limits the dumps being written in the background.
+var pendingDumps = make(chan struct{}, maxPendingDumps)
+
+// isDumpedHeader reports whether the header is kept in the dumps, as opposed
+// to the credentials, see dumpSecretHeaders.
+func isDumpedHeader(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range dumpSecretHeaders {
+		if strings.Contains(name, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// dumpRequest returns the dump of the request of the entry, in the HTTP/1.1
+// wire format, with the part of its body read by the handler, for the replay
+// package. The request id is set in the X-Request-Id header, the credentials
+// are left out, and the secrets are masked with RedactSecrets.
+func (l *HTTPLoggerEntry) dumpRequest(reqID string) ([]byte, error) {
+	r := l.req.Clone(l.req.Context())
+	var body []byte
+	if l.dump != nil {
+		body = l.dump.bytes()
+	}
+	for name := range r.Header {
+		if !isDumpedHeader(name) {
+			r.Header.Del(name)
+		}
+	}
+	if l.conf().RedactSecrets {
+		body = []byte(redactString(string(body)))
+		for _, values := range r.Header {
+			for i, v := range values {
+				values[i] = redactString(v)
+			}
+		}
+		u := *r.URL
+		u.User = nil
+		if q := u.Query(); len(q) > 0 {
+			for _, values := range q {
+				for i, v := range values {
+					values[i] = redactString(v)
+				}
+			}
+			u.RawQuery = q.Encode()
+		}
+		r.URL = &u
+		r.RequestURI = u.RequestURI()
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.TransferEncoding = nil
+	r.Header.Set(middleware.RequestIDHeader, reqID)
+	return httputil.DumpRequest(r, true)
+}
+
+// writeDump writes the dump of the request of the entry to <req_id>.http in
+// the DumpDir of the config in the background, or to <req_id>-<n>.http if it
+// already exists, as the request id may come from the client. The errors are
+// reported to stderr.
+func (l *HTTPLoggerEntry) writeDump() {
+	reqID := middleware.GetReqID(l.req.Context())
+	name := requestFileName(reqID)
+	if name == "" {
+		return
+	}
+	b, err := l.dumpRequest(reqID)
+	if err != nil {
+		atomic.AddUint64(&counters.SinkErrors, 1)
+		fmt.Fprintf(os.Stderr, "lg: failed to dump request: %v\n", err)
+		return
+	}
+	select {
+	case pendingDumps <- struct{}{}:
+	default:
+		atomic.AddUint64(&counters.SinkErrors, 1)
+		fmt.Fprintf(os.Stderr, "lg: too many pending dumps, dropped the dump of request %s\n", reqID)
+		return
+	}
+	dir := l.conf().DumpDir
+	go func() {
+		defer func() { <-pendingDumps }()
+		if err := writeDumpFile(dir, name, b); err != nil {
+			atomic.AddUint64(&counters.SinkErrors, 1)
+			fmt.Fprintf(os.Stderr, "lg: failed to dump request: %v\n", err)
+		}
+	}()
+}
+
+// writeDumpFile writes a dump to a new file of dir named after name.
+func writeDumpFile(dir, name string, b []byte) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	for n := 0; n < maxDumpVariants; n++ {
+		path := filepath.Join(dir, name+".http")
+		if n > 0 {
+			path = filepath.Join(dir, fmt.Sprintf("%s-%d.http", name, n))
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(b); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+	return fmt.Errorf("%d dumps of %s already exist", maxDumpVariants, name)
+}
@@ -0,0 +1,53 @@
+package lg
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ConfigFromEnv reads the configuration from the environment variables
+// LG_LEVEL, LG_FORMAT, LG_SAMPLE_RATE, LG_SKIP_PATHS (comma separated),
+// LG_REQUEST_ID, LG_REDACT_SECRETS, LG_MAX_FIELD_LENGTH and LG_MAX_ENTRY_SIZE.
+// Unset variables are left to their zero value.
+func ConfigFromEnv() (Config, error) {
+	var c Config
+	var err error
+
+	c.Level = os.Getenv("LG_LEVEL")
+	c.Format = os.Getenv("LG_FORMAT")
+	if val := os.Getenv("LG_SAMPLE_RATE"); val != "" {
+		if c.SampleRate, err = strconv.ParseFloat(val, 64); err != nil {
+			return c, fmt.Errorf("lg: invalid LG_SAMPLE_RATE %q: %v", val, err)
+		}
+	}
+	if val := os.Getenv("LG_SKIP_PATHS"); val != "" {
+		for _, p := range strings.Split(val, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				c.SkipPaths = append(c.SkipPaths, p)
+			}
+		}
+	}
+	if val := os.Getenv("LG_REQUEST_ID"); val != "" {
+		if c.RequestID, err = strconv.ParseBool(val); err != nil {
+			return c, fmt.Errorf("lg: invalid LG_REQUEST_ID %q: %v", val, err)
+		}
+	}
+	if val := os.Getenv("LG_REDACT_SECRETS"); val != "" {
+		if c.RedactSecrets, err = strconv.ParseBool(val); err != nil {
+			return c, fmt.Errorf("lg: invalid LG_REDACT_SECRETS %q: %v", val, err)
+		}
+	}
+	if val := os.Getenv("LG_MAX_FIELD_LENGTH"); val != "" {
+		if c.MaxFieldLength, err = strconv.Atoi(val); err != nil {
+			return c, fmt.Errorf("lg: invalid LG_MAX_FIELD_LENGTH %q: %v", val, err)
+		}
+	}
+	if val := os.Getenv("LG_MAX_ENTRY_SIZE"); val != "" {
+		if c.MaxEntrySize, err = strconv.Atoi(val); err != nil {
+			return c, fmt.Errorf("lg: invalid LG_MAX_ENTRY_SIZE %q: %v", val, err)
+		}
+	}
+	return c, nil
+}
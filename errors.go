@@ -0,0 +1,43 @@
+package lg
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrorClassifier classifies the errors logged with LogError and the errors of
+// the requests, such as "validation" or "dependency", into the err_kind and
+// err_retryable fields, so dashboards can tell them apart. Errors are not
+// classified when nil.
+var ErrorClassifier func(err error) (kind string, retryable bool)
+
+// errorFields returns the fields of the classification of err.
+func errorFields(err error) logrus.Fields {
+	if ErrorClassifier == nil || err == nil {
+		return nil
+	}
+	kind, retryable := ErrorClassifier(err)
+	return logrus.Fields{"err_kind": kind, "err_retryable": retryable}
+}
+
+// LogError logs err at the error level with the logger of ctx, or
+// DefaultLogger, classified with ErrorClassifier. Within a request, err is
+// also recorded as the error of the request, and its classification is added
+// to the completion line, unless the request panics. A nil err is ignored.
+func LogError(ctx context.Context, err error) {
+	if err == nil {
+		return
+	}
+	if entry, ok := GetLogEntry(ctx); ok {
+		entry = entry.root()
+		entry.mu.Lock()
+		entry.loggedErr = err
+		entry.mu.Unlock()
+	}
+	logger := loggerOrDefault(ctx).WithError(err)
+	if fields := errorFields(err); fields != nil {
+		logger = logger.WithFields(fields)
+	}
+	withCaller(logger, 1).Errorln(err.Error())
+}
@@ -0,0 +1,27 @@
+package lg
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+// EventLogger is the logger that business events are routed to. When nil,
+// events are written with the logger of the context, along with every other
+// line. The fields of the events of a request are rewritten as for its other
+// lines, such as by RedactSecrets, see entryFormatter.
+var EventLogger *logrus.Logger
+
+// EventKey is the reserved field name holding the name of a business event.
+var EventKey = "event"
+
+// Event writes a business event, such as "order.created", with the given
+// fields. The entry inherits the fields of the request entry on the context
+// (req_id, uri, etc.), and the event name is stored in the EventKey field.
+func Event(ctx context.Context, name string, fields logrus.Fields) {
+	entry := withCaller(contextLogger(ctx), 1).WithFields(fields).WithField(EventKey, name)
+	if EventLogger != nil {
+		entry.Logger = entryLogger(EventLogger)
+	}
+	entry.Info(name)
+}
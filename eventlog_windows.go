@@ -0,0 +1,59 @@
+//go:build windows
+// +build windows
+
+package lg
+
+import (
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// EventLogHook is a logrus hook writing the entries to the Windows Event Log,
+// with the JSON entry as the message. Debug and info entries are written as
+// information events, warnings as warning events, and errors as error events.
+//
+// The event source must be registered once, by an administrator, such as with
+// eventlog.InstallAsEventCreate from golang.org/x/sys/windows/svc/eventlog.
+type EventLogHook struct {
+	// EventID is the id of the events, 1 by default.
+	EventID uint32
+
+	log       *eventlog.Log
+	formatter logrus.JSONFormatter
+}
+
+// NewEventLogHook opens the Event Log for the given event source.
+func NewEventLogHook(source string) (*EventLogHook, error) {
+	log, err := eventlog.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	return &EventLogHook{EventID: 1, log: log}, nil
+}
+
+func (h *EventLogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *EventLogHook) Fire(entry *logrus.Entry) error {
+	b, err := h.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	msg := strings.TrimSuffix(string(b), "\n")
+	switch entry.Level {
+	case logrus.DebugLevel, logrus.InfoLevel:
+		return h.log.Info(h.EventID, msg)
+	case logrus.WarnLevel:
+		return h.log.Warning(h.EventID, msg)
+	default:
+		return h.log.Error(h.EventID, msg)
+	}
+}
+
+// Close closes the Event Log.
+func (h *EventLogHook) Close() error {
+	return h.log.Close()
+}
@@ -0,0 +1,70 @@
+package lg
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// fatalHook turns the fatal lines of a request into errors aborting the
+// request, see RequestLoggerConfig.InterceptFatal.
+type fatalHook struct{}
+
+// fatalError is the panic aborting a request which logged a fatal line.
+type fatalError struct {
+	msg string
+}
+
+func (e *fatalError) Error() string {
+	return "lg: fatal error intercepted: " + e.msg
+}
+
+func (h fatalHook) Levels() []logrus.Level {
+	return []logrus.Level{logrus.FatalLevel}
+}
+
+// Fire writes the line at the error level, as the hooks are fired before the
+// line is written, and panics before logrus exits. The lock of the logger is
+// held by logrus while the hooks fire.
+func (h fatalHook) Fire(entry *logrus.Entry) error {
+	e := *entry
+	e.Level = logrus.ErrorLevel
+	e.Data = make(logrus.Fields, len(entry.Data)+1)
+	for k, v := range entry.Data {
+		e.Data[k] = v
+	}
+	e.Data["fatal_intercepted"] = true
+	if b, err := e.Logger.Formatter.Format(&e); err == nil {
+		if _, err := e.Logger.Out.Write(b); err != nil {
+			fmt.Fprintf(os.Stderr, "lg: failed to write to log: %v\n", err)
+		}
+	}
+	panic(&fatalError{entry.Message})
+}
+
+// fatalLoggers holds the loggers intercepting the fatal lines of the parent
+// loggers, retained as the entryLoggers.
+var fatalLoggers sync.Map
+
+// interceptFatalLogger returns the logger sharing the output, formatter, level
+// and hooks of parent, on which the fatal lines abort the request instead of
+// exiting. It's created once per parent.
+func interceptFatalLogger(parent *logrus.Logger) *logrus.Logger {
+	v, ok := fatalLoggers.Load(parent)
+	if !ok {
+		hooks := logrus.LevelHooks{}
+		hooks.Add(parentHooks{parent})
+		hooks.Add(fatalHook{})
+		v, _ = fatalLoggers.LoadOrStore(parent, &logrus.Logger{
+			Out:       sharedOutput(parent),
+			Formatter: parentFormatter{parent},
+			Hooks:     hooks,
+			Level:     loggerLevel(parent),
+		})
+	}
+	logger := v.(*logrus.Logger)
+	logger.SetLevel(loggerLevel(parent))
+	return logger
+}
@@ -0,0 +1,294 @@
+package lg
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FieldPathSeparator is the separator of the field paths, such as
+// "http.request.method", see FieldPathFormatter.
+var FieldPathSeparator = "."
+
+// FieldPathFormatter wraps a logrus formatter and rewrites dotted field paths
+// before formatting. With Nested set, "http.request.method" is emitted as
+// {"http":{"request":{"method":...}}}, as expected by ECS or GCP. Otherwise
+// the path is flattened with Separator, such as "http_request_method".
+type FieldPathFormatter struct {
+	Formatter logrus.Formatter
+	Nested    bool
+	Separator string
+}
+
+func (f *FieldPathFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	e := *entry
+	if f.Nested {
+		e.Data = nestFields(entry.Data)
+	} else if f.Separator != "" && f.Separator != FieldPathSeparator {
+		e.Data = make(logrus.Fields, len(entry.Data))
+		for k, v := range entry.Data {
+			e.Data[strings.Replace(k, FieldPathSeparator, f.Separator, -1)] = v
+		}
+	}
+	return f.Formatter.Format(&e)
+}
+
+// fieldNode is an object created by nestFields for the segments of the
+// paths, as opposed to the map values of the fields, which are never modified.
+type fieldNode map[string]interface{}
+
+// nestFields expands the dotted keys of fields into nested maps. The paths are
+// expanded by depth then name, so that when a path collides with a field of
+// the same name, such as "a.b" with "a.b.c", the longer one is left flat.
+func nestFields(fields logrus.Fields) logrus.Fields {
+	data := make(logrus.Fields, len(fields))
+	var paths []string
+	for k, v := range fields {
+		if strings.Contains(k, FieldPathSeparator) {
+			paths = append(paths, k)
+		} else {
+			data[k] = v
+		}
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		di, dj := strings.Count(paths[i], FieldPathSeparator), strings.Count(paths[j], FieldPathSeparator)
+		if di != dj {
+			return di < dj
+		}
+		return paths[i] < paths[j]
+	})
+	for _, k := range paths {
+		parts := strings.Split(k, FieldPathSeparator)
+		node := fieldNode(data)
+		for _, p := range parts[:len(parts)-1] {
+			child, ok := node[p]
+			if !ok {
+				child = fieldNode{}
+				node[p] = child
+			}
+			if node, ok = child.(fieldNode); !ok {
+				break
+			}
+		}
+		if _, taken := node[parts[len(parts)-1]]; node == nil || taken {
+			data[k] = fieldValue(fields[k])
+			continue
+		}
+		node[parts[len(parts)-1]] = fieldValue(fields[k])
+	}
+	return data
+}
+
+// ConsoleFormatter is a colorized, single-line formatter for local
+// development, such as:
+//
+//	12:04:05.123 INFO GET /articles 200 12.1ms req_id=abc
+//
+// The stack trace of a recovered panic is expanded over multiple lines. The
+// lines are colorized when the output of the logger is a terminal, unless
+// DisableColors is set, or whatever the output with ForceColors.
+type ConsoleFormatter struct {
+	DisableColors bool
+	ForceColors   bool
+
+	once   sync.Once
+	colors bool
+}
+
+const (
+	colorRed    = 31
+	colorYellow = 33
+	colorBlue   = 36
+	colorGray   = 37
+)
+
+// consoleSummaryKeys are the fields folded into the summary of request lines.
+var consoleSummaryKeys = map[string]bool{
+	"http_method": true, "uri": true, "resp_status": true, "resp_elapsed_ms": true,
+	"panic": true, "stack": true,
+}
+
+func (f *ConsoleFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	f.once.Do(func() {
+		f.colors = !f.DisableColors && (f.ForceColors || entry.Logger != nil && isTerminal(entry.Logger.Out))
+	})
+	b := &bytes.Buffer{}
+
+	levelColor := colorBlue
+	switch entry.Level {
+	case logrus.DebugLevel:
+		levelColor = colorGray
+	case logrus.WarnLevel:
+		levelColor = colorYellow
+	case logrus.ErrorLevel, logrus.FatalLevel, logrus.PanicLevel:
+		levelColor = colorRed
+	}
+	b.WriteString(entry.Time.Format("15:04:05.000"))
+	b.WriteByte(' ')
+	f.colorize(b, levelColor, strings.ToUpper(entry.Level.String())[:4])
+	b.WriteByte(' ')
+
+	method, isRequest := entry.Data["http_method"].(string)
+	if isRequest {
+		path := fmt.Sprint(entry.Data["uri"])
+		if u, err := url.Parse(path); err == nil {
+			path = u.RequestURI()
+		}
+		b.WriteString(method + " " + path)
+		if status, ok := entry.Data["resp_status"]; ok {
+			fmt.Fprintf(b, " %v", status)
+			if ms, ok := entry.Data["resp_elapsed_ms"].(float64); ok {
+				fmt.Fprintf(b, " %.1fms", ms)
+			}
+		} else {
+			b.WriteString(" " + entry.Message)
+		}
+	} else {
+		b.WriteString(entry.Message)
+	}
+
+	keys := make([]string, 0, len(entry.Data))
+	for k := range entry.Data {
+		if isRequest && consoleSummaryKeys[k] {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteByte(' ')
+		f.colorize(b, colorGray, k+"=")
+		fmt.Fprintf(b, "%v", entry.Data[k])
+	}
+	b.WriteByte('\n')
+
+	if rec, ok := entry.Data["panic"]; ok && isRequest {
+		f.colorize(b, colorRed, fmt.Sprintf("\nPANIC: %v\n", rec))
+		fmt.Fprintf(b, "%v\n", entry.Data["stack"])
+	}
+	return b.Bytes(), nil
+}
+
+func (f *ConsoleFormatter) colorize(b *bytes.Buffer, color int, s string) {
+	if !f.colors {
+		b.WriteString(s)
+		return
+	}
+	fmt.Fprintf(b, "\x1b[%dm%s\x1b[0m", color, s)
+}
+
+// isTerminal reports whether w writes to a terminal, through the outputs of
+// the loggers derived by lg.
+func isTerminal(w io.Writer) bool {
+	for {
+		switch o := w.(type) {
+		case *lockedWriter:
+			w = o.w
+		case parentOutput:
+			w = o.parent.Out
+		case *os.File:
+			fi, err := o.Stat()
+			return err == nil && fi.Mode()&os.ModeCharDevice != 0
+		default:
+			return false
+		}
+	}
+}
+
+// RequestSummaryFormatter wraps a logrus formatter, usually the JSON one, and
+// groups the fields of the request lines into nested objects, for consumers
+// with strict schemas:
+//
+//	{"request":{...},"response":{...},"timings":{...},"app_fields":{...}}
+//
+// Other lines are formatted as is.
+type RequestSummaryFormatter struct {
+	Formatter logrus.Formatter
+}
+
+// summaryTimingKeys are the fields grouped under timings, besides the
+// durations in milliseconds.
+var summaryTimingKeys = map[string]bool{
+	"resp_elapsed_bucket": true, "slow": true, "deadline_exceeded": true,
+	"latency_anomaly": true, "timed_out": true,
+}
+
+// summaryRequestKeys are the fields grouped under request, besides the req_
+// and http_ fields.
+var summaryRequestKeys = map[string]bool{
+	"uri": true, "remote_addr": true, "user_agent": true,
+	"X-Forwarded-For": true, "X-Forwarded-Host": true, "X-Forwarded-Scheme": true,
+}
+
+func (f *RequestSummaryFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	if _, isRequest := entry.Data["http_method"]; !isRequest {
+		return f.Formatter.Format(entry)
+	}
+	groups := map[string]logrus.Fields{
+		"request": {}, "response": {}, "timings": {}, "app_fields": {},
+	}
+	for k, v := range entry.Data {
+		v = fieldValue(v)
+		switch {
+		case summaryTimingKeys[k] || strings.HasSuffix(k, "_ms"):
+			groups["timings"][k] = v
+		case strings.HasPrefix(k, "resp_") || k == "not_modified":
+			groups["response"][k] = v
+		case strings.HasPrefix(k, "req_") || strings.HasPrefix(k, "http_") || summaryRequestKeys[k]:
+			groups["request"][k] = v
+		default:
+			groups["app_fields"][k] = v
+		}
+	}
+	e := *entry
+	e.Data = make(logrus.Fields, len(groups))
+	for name, fields := range groups {
+		if len(fields) > 0 {
+			e.Data[name] = fields
+		}
+	}
+	return f.Formatter.Format(&e)
+}
+
+// fieldValue returns the message of an error value, which would be written as
+// an empty object once nested, as the formatters only convert the errors of
+// the top-level fields.
+func fieldValue(v interface{}) interface{} {
+	if err, ok := v.(error); ok {
+		return err.Error()
+	}
+	return v
+}
+
+// NewFormatter returns the formatter with the given name: "json" for
+// production, "summary" for JSON with the request lines grouped by
+// RequestSummaryFormatter, "protobuf" for length-prefixed protobuf records,
+// "msgpack" for MessagePack records, "cbor" for CBOR records, "console" for
+// local development, or "text" for the logrus text formatter. It returns nil
+// for unknown names.
+func NewFormatter(name string) logrus.Formatter {
+	switch strings.ToLower(name) {
+	case "json":
+		return &logrus.JSONFormatter{}
+	case "summary":
+		return &RequestSummaryFormatter{Formatter: &logrus.JSONFormatter{}}
+	case "protobuf":
+		return &ProtobufFormatter{}
+	case "msgpack":
+		return &MsgpackFormatter{}
+	case "cbor":
+		return &CBORFormatter{}
+	case "console":
+		return &ConsoleFormatter{}
+	case "text":
+		return &logrus.TextFormatter{}
+	}
+	return nil
+}
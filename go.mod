@@ -1,8 +1,14 @@
 module github.com/pressly/lg
 
+go 1.21
+
 require (
+	github.com/fsnotify/fsnotify v1.6.0
 	github.com/go-chi/chi v3.3.2+incompatible
+	github.com/go-chi/chi/v5 v5.1.0
 	github.com/sirupsen/logrus v1.0.6
-	golang.org/x/crypto v0.0.0-20180820150726-614d502a4dac // indirect
-	golang.org/x/sys v0.0.0-20180821140842-3b58ed4ad339 // indirect
+	golang.org/x/sys v0.13.0
+	gopkg.in/yaml.v3 v3.0.1
 )
+
+require golang.org/x/crypto v0.0.0-20180820150726-614d502a4dac // indirect
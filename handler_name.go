@@ -0,0 +1,54 @@
+package lg
+
+import (
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// HandlerKey is the field holding the name of the handler of a request.
+var HandlerKey = "handler"
+
+// HandlerName is a middleware setting the handler field of the request entry,
+// so that the logs map to code even when routes share a pattern:
+//
+//	r.With(lg.HandlerName("articles.List")).Get("/articles", List)
+func HandlerName(name string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			SetEntryField(r.Context(), HandlerKey, name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// NamedHandler wraps fn to set the handler field of the request entry to the
+// name of the function, found by reflection, such as "main.List":
+//
+//	r.Get("/articles", lg.NamedHandler(List))
+func NamedHandler(fn http.HandlerFunc) http.HandlerFunc {
+	name := funcName(fn)
+	return func(w http.ResponseWriter, r *http.Request) {
+		SetEntryField(r.Context(), HandlerKey, name)
+		fn(w, r)
+	}
+}
+
+// funcName returns the name of the function fn, without the package path.
+func funcName(fn interface{}) string {
+	f := runtime.FuncForPC(reflect.ValueOf(fn).Pointer())
+	if f == nil {
+		return ""
+	}
+	return funcNameOf(f.Name())
+}
+
+// funcNameOf returns the name of a function without its package path, such
+// as "main.List" for "github.com/org/app/main.List".
+func funcNameOf(name string) string {
+	if i := strings.LastIndexByte(name, '/'); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.TrimSuffix(name, "-fm")
+}
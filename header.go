@@ -0,0 +1,14 @@
+package lg
+
+import "strings"
+
+// headerFieldKey returns the field key of a header, such as resp_cache_control
+// for the Cache-Control header with the resp_ prefix.
+func headerFieldKey(prefix, name string) string {
+	return prefix + strings.ToLower(strings.Replace(name, "-", "_", -1))
+}
+
+// hasPrefixFold reports whether s starts with prefix, ignoring case.
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
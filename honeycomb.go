@@ -0,0 +1,77 @@
+package lg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// HoneycombInserter sends access records to the Honeycomb events API, one wide
+// event per request holding all the fields accumulated on its entry. Use it
+// with a TableSink:
+//
+//	sink := lg.NewTableSink(&lg.HoneycombInserter{APIKey: key, Dataset: "api"}, 100, time.Second)
+type HoneycombInserter struct {
+	APIKey  string
+	Dataset string
+	APIHost string       // defaults to https://api.honeycomb.io
+	Client  *http.Client // defaults to http.DefaultClient
+}
+
+type honeycombEvent struct {
+	Time string                 `json:"time"`
+	Data map[string]interface{} `json:"data"`
+}
+
+func (h *HoneycombInserter) InsertRecords(ctx context.Context, records []AccessRecord) error {
+	events := make([]honeycombEvent, len(records))
+	for i, rec := range records {
+		data := jsonFields(rec.Fields)
+		data["method"] = rec.Method
+		data["route"] = rec.Route
+		data["status"] = rec.Status
+		data["duration_ms"] = float64(rec.Duration.Nanoseconds()) / 1000000.0
+		data["req_id"] = rec.ReqID
+		if rec.User != "" {
+			data["user"] = rec.User
+		}
+		events[i] = honeycombEvent{Time: rec.Time.Format(time.RFC3339Nano), Data: data}
+	}
+	body, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+
+	host := h.APIHost
+	if host == "" {
+		host = "https://api.honeycomb.io"
+	}
+	req, err := http.NewRequest("POST", host+"/1/batch/"+url.PathEscape(h.Dataset), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Honeycomb-Team", h.APIKey)
+
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("lg: honeycomb responded %s", resp.Status)
+	}
+	return nil
+}
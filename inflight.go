@@ -0,0 +1,48 @@
+package lg
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// inFlight are the requests in flight of the request loggers with
+// TrackInFlight, with their start time.
+var inFlight = struct {
+	sync.Mutex
+	entries map[*HTTPLoggerEntry]time.Time
+}{entries: map[*HTTPLoggerEntry]time.Time{}}
+
+func trackInFlight(entry *HTTPLoggerEntry, start time.Time) {
+	inFlight.Lock()
+	defer inFlight.Unlock()
+	inFlight.entries[entry] = start
+}
+
+func untrackInFlight(entry *HTTPLoggerEntry) {
+	inFlight.Lock()
+	defer inFlight.Unlock()
+	delete(inFlight.entries, entry)
+}
+
+// LogAbortedRequests writes a "request aborted" line, with
+// outcome=aborted_shutdown, for each request still in flight, when the server
+// stops without waiting for them, so they don't vanish from the logs. It
+// applies to the request loggers with TrackInFlight, and is called by Serve
+// when the graceful shutdown times out.
+func LogAbortedRequests() {
+	inFlight.Lock()
+	entries := make(map[*HTTPLoggerEntry]time.Time, len(inFlight.entries))
+	for entry, start := range inFlight.entries {
+		entries[entry] = start
+	}
+	inFlight.Unlock()
+
+	for entry, start := range entries {
+		entry.logWith(logrus.Fields{
+			"outcome":         "aborted_shutdown",
+			"resp_elapsed_ms": float64(time.Since(start).Nanoseconds()) / 1000000.0,
+		}, logrus.WarnLevel, "request aborted")
+	}
+}
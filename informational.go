@@ -0,0 +1,173 @@
+package lg
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/sirupsen/logrus"
+)
+
+// informationalWriter passes the 1xx informational responses of the handler,
+// such as 103 Early Hints, through to the client and records them on the
+// entry, with InformationalResponses. chi's response writer only forwards the
+// first status, so it would drop the final status of the response after a
+// 1xx. With ServerTiming, it also sets the Server-Timing header of the
+// response before its header is written, and with StatusAssertions, it flags
+// the misuses of the status by the handler. With WriteErrors, it records the
+// errors writing the body.
+type informationalWriter struct {
+	middleware.WrapResponseWriter
+	entry *HTTPLoggerEntry
+}
+
+// newInformationalWriter wraps ww, keeping the optional interfaces it
+// implements, as middleware.NewWrapResponseWriter does.
+func newInformationalWriter(ww middleware.WrapResponseWriter, entry *HTTPLoggerEntry) http.ResponseWriter {
+	iw := &informationalWriter{ww, entry}
+	_, fl := ww.(http.Flusher)
+	_, hj := ww.(http.Hijacker)
+	_, rf := ww.(io.ReaderFrom)
+	_, ps := ww.(http.Pusher)
+	switch {
+	case fl && ps:
+		return &informationalHTTP2Writer{iw}
+	case fl && hj && rf:
+		return &informationalFancyWriter{iw}
+	case fl && hj:
+		return &informationalFlushHijackWriter{iw}
+	case hj:
+		return &informationalHijackWriter{iw}
+	case fl:
+		return &informationalFlushWriter{iw}
+	}
+	return iw
+}
+
+func (w *informationalWriter) WriteHeader(code int) {
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols && w.entry.conf().InformationalResponses {
+		if w.Status() == 0 {
+			w.entry.addInformational(code)
+			w.WrapResponseWriter.Unwrap().WriteHeader(code)
+		}
+		return
+	}
+	if w.entry.conf().StatusAssertions && w.Status() != 0 {
+		w.entry.assertStatus("status written after the response header")
+	}
+	w.beforeHeader()
+	w.WrapResponseWriter.WriteHeader(code)
+}
+
+func (w *informationalWriter) Write(p []byte) (int, error) {
+	w.beforeWrite()
+	n, err := w.WrapResponseWriter.Write(p)
+	if err != nil && w.entry.conf().WriteErrors {
+		w.entry.setWriteErr(err)
+	}
+	return n, err
+}
+
+// beforeWrite flags the writes without status, with StatusAssertions, and
+// sets the header before the body is written.
+func (w *informationalWriter) beforeWrite() {
+	if w.entry.conf().StatusAssertions && w.Status() == 0 {
+		w.entry.assertStatus("body written without status, implicit 200")
+	}
+	w.beforeHeader()
+}
+
+// beforeHeader sets the Server-Timing header, before the header of the
+// response is written.
+func (w *informationalWriter) beforeHeader() {
+	if w.entry.conf().ServerTiming && w.Status() == 0 {
+		w.Header().Set("Server-Timing", w.entry.serverTiming())
+	}
+}
+
+func (w *informationalWriter) Unwrap() http.ResponseWriter {
+	return w.WrapResponseWriter
+}
+
+type informationalFlushWriter struct {
+	*informationalWriter
+}
+
+func (w *informationalFlushWriter) Flush() {
+	w.WrapResponseWriter.(http.Flusher).Flush()
+}
+
+type informationalHijackWriter struct {
+	*informationalWriter
+}
+
+func (w *informationalHijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.WrapResponseWriter.(http.Hijacker).Hijack()
+}
+
+type informationalFlushHijackWriter struct {
+	*informationalWriter
+}
+
+func (w *informationalFlushHijackWriter) Flush() {
+	w.WrapResponseWriter.(http.Flusher).Flush()
+}
+
+func (w *informationalFlushHijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.WrapResponseWriter.(http.Hijacker).Hijack()
+}
+
+type informationalFancyWriter struct {
+	*informationalWriter
+}
+
+func (w *informationalFancyWriter) Flush() {
+	w.WrapResponseWriter.(http.Flusher).Flush()
+}
+
+func (w *informationalFancyWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.WrapResponseWriter.(http.Hijacker).Hijack()
+}
+
+func (w *informationalFancyWriter) ReadFrom(r io.Reader) (int64, error) {
+	w.beforeWrite()
+	n, err := w.WrapResponseWriter.(io.ReaderFrom).ReadFrom(r)
+	if err != nil && w.entry.conf().WriteErrors {
+		w.entry.setWriteErr(err)
+	}
+	return n, err
+}
+
+type informationalHTTP2Writer struct {
+	*informationalWriter
+}
+
+func (w *informationalHTTP2Writer) Flush() {
+	w.WrapResponseWriter.(http.Flusher).Flush()
+}
+
+func (w *informationalHTTP2Writer) Push(target string, opts *http.PushOptions) error {
+	return w.WrapResponseWriter.(http.Pusher).Push(target, opts)
+}
+
+// trailerFields returns the fields of the given response trailers which are
+// set, named after the trailer, such as resp_trailer_grpc_status.
+func (l *HTTPLoggerEntry) trailerFields(names []string) logrus.Fields {
+	fields := logrus.Fields{}
+	if l.resp == nil {
+		return fields
+	}
+	header := l.resp.Header()
+	for _, name := range names {
+		val := header.Get(name)
+		if val == "" {
+			val = header.Get(http.TrailerPrefix + name)
+		}
+		if val != "" {
+			fields[headerFieldKey("resp_trailer_", name)] = val
+		}
+	}
+	return fields
+}
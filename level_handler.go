@@ -0,0 +1,61 @@
+package lg
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LevelHandler is an admin endpoint to list and change the levels of the
+// components at runtime. GET returns the levels as a JSON object, such as
+// {"db":"debug","cache":"info"}. POST or PUT sets the levels of the given JSON
+// object, an empty level resetting the component to the level of its parent
+// logger. It should be mounted on an internal, authenticated route:
+//
+//	r.Mount("/admin/log-levels", lg.LevelHandler())
+func LevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodPost, http.MethodPut:
+			var req map[string]string
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "invalid levels: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			levels := map[string]logrus.Level{}
+			for name, val := range req {
+				if val == "" {
+					continue
+				}
+				level, err := logrus.ParseLevel(val)
+				if err != nil {
+					http.Error(w, "invalid level of "+name+": "+err.Error(), http.StatusBadRequest)
+					return
+				}
+				levels[name] = level
+			}
+			for name, val := range req {
+				if val == "" {
+					ResetComponentLevel(name)
+				} else {
+					SetComponentLevel(name, levels[name])
+				}
+			}
+			loggerOrDefault(r.Context()).WithField("levels", req).Infoln("component levels changed")
+		default:
+			w.Header().Set("Allow", "GET, POST, PUT")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		levels := map[string]string{}
+		for name, level := range Levels() {
+			levels[name] = strings.ToLower(level.String())
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(levels)
+	})
+}
@@ -0,0 +1,18 @@
+// Package lgexpvar publishes the internal counters of lg with expvar. It's a
+// package of its own, as importing expvar registers /debug/vars, exposing the
+// command line and memory statistics, on http.DefaultServeMux:
+//
+//	lgexpvar.Publish()
+package lgexpvar
+
+import (
+	"expvar"
+
+	"github.com/pressly/lg"
+)
+
+// Publish publishes lg.Stats with expvar, under "lg". It panics if "lg" is
+// already published, as expvar.Publish does.
+func Publish() {
+	expvar.Publish("lg", expvar.Func(func() interface{} { return lg.Stats() }))
+}
@@ -0,0 +1,148 @@
+package lg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// MsgpackFormatter formats the entries as MessagePack maps, with the same keys
+// as the logrus JSON formatter (time, level, msg and the fields), for
+// shippers sensitive to bandwidth. The records are self-delimiting, and can be
+// read back with the lg/msgpack package.
+type MsgpackFormatter struct{}
+
+func (f *MsgpackFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	keys := make([]string, 0, len(entry.Data))
+	for k := range entry.Data {
+		if k != "time" && k != "level" && k != "msg" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	b := mpAppendMapHeader(nil, len(keys)+3)
+	b = mpAppendString(b, "time")
+	b = mpAppendString(b, entry.Time.Format(time.RFC3339Nano))
+	b = mpAppendString(b, "level")
+	b = mpAppendString(b, entry.Level.String())
+	b = mpAppendString(b, "msg")
+	b = mpAppendString(b, entry.Message)
+	for _, k := range keys {
+		b = mpAppendString(b, k)
+		b = mpAppendValue(b, entry.Data[k])
+	}
+	return b, nil
+}
+
+func mpAppendValue(b []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0xc0)
+	case bool:
+		if v {
+			return append(b, 0xc3)
+		}
+		return append(b, 0xc2)
+	case int:
+		return mpAppendInt(b, int64(v))
+	case int32:
+		return mpAppendInt(b, int64(v))
+	case int64:
+		return mpAppendInt(b, v)
+	case uint32:
+		return mpAppendInt(b, int64(v))
+	case float32:
+		return mpAppendFloat(b, float64(v))
+	case float64:
+		return mpAppendFloat(b, v)
+	case string:
+		return mpAppendString(b, v)
+	case error:
+		return mpAppendString(b, v.Error())
+	case []string:
+		b = mpAppendArrayHeader(b, len(v))
+		for _, s := range v {
+			b = mpAppendString(b, s)
+		}
+		return b
+	case map[string]interface{}:
+		return mpAppendMap(b, v)
+	case logrus.Fields:
+		return mpAppendMap(b, v)
+	default:
+		return mpAppendString(b, fmt.Sprintf("%+v", v))
+	}
+}
+
+func mpAppendMap(b []byte, m map[string]interface{}) []byte {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	b = mpAppendMapHeader(b, len(keys))
+	for _, k := range keys {
+		b = mpAppendString(b, k)
+		b = mpAppendValue(b, m[k])
+	}
+	return b
+}
+
+func mpAppendInt(b []byte, v int64) []byte {
+	switch {
+	case v >= 0 && v < 128:
+		return append(b, byte(v))
+	case v < 0 && v >= -32:
+		return append(b, byte(v))
+	}
+	b = append(b, 0xd3)
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(v))
+	return append(b, buf[:]...)
+}
+
+func mpAppendFloat(b []byte, v float64) []byte {
+	b = append(b, 0xcb)
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], math.Float64bits(v))
+	return append(b, buf[:]...)
+}
+
+func mpAppendString(b []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n < 1<<8:
+		b = append(b, 0xd9, byte(n))
+	case n < 1<<16:
+		b = append(b, 0xda, byte(n>>8), byte(n))
+	default:
+		b = append(b, 0xdb, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(b, s...)
+}
+
+func mpAppendArrayHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x90|byte(n))
+	case n < 1<<16:
+		return append(b, 0xdc, byte(n>>8), byte(n))
+	}
+	return append(b, 0xdd, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func mpAppendMapHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x80|byte(n))
+	case n < 1<<16:
+		return append(b, 0xde, byte(n>>8), byte(n))
+	}
+	return append(b, 0xdf, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
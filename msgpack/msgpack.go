@@ -0,0 +1,179 @@
+// Package msgpack decodes the records written by lg.MsgpackFormatter, to
+// inspect binary logs locally, such as:
+//
+//	msgpack.Dump(os.Stdout, os.Stdin)
+package msgpack
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Decoder reads the records of a MessagePack log stream.
+type Decoder struct {
+	r *bufio.Reader
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Decode returns the next record of the stream, or io.EOF at the end of it.
+func (d *Decoder) Decode() (map[string]interface{}, error) {
+	v, err := d.value()
+	if err != nil {
+		return nil, err
+	}
+	record, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("msgpack: record is a %T, not a map", v)
+	}
+	return record, nil
+}
+
+// Dump writes the records of r to w as JSON lines.
+func Dump(w io.Writer, r io.Reader) error {
+	dec := NewDecoder(r)
+	enc := json.NewEncoder(w)
+	for {
+		record, err := dec.Decode()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := enc.Encode(record); err != nil {
+			return err
+		}
+	}
+}
+
+var errTruncated = errors.New("msgpack: truncated record")
+
+func (d *Decoder) value() (interface{}, error) {
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xe0 == 0xa0:
+		return d.str(int(c & 0x1f))
+	case c&0xf0 == 0x90:
+		return d.array(int(c & 0x0f))
+	case c&0xf0 == 0x80:
+		return d.m(int(c & 0x0f))
+	}
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcb:
+		n, err := d.uint(8)
+		return math.Float64frombits(n), err
+	case 0xd3:
+		n, err := d.uint(8)
+		return int64(n), err
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(int(n))
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.array(int(n))
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.m(int(n))
+	}
+	return nil, fmt.Errorf("msgpack: unsupported type 0x%x", c)
+}
+
+func (d *Decoder) uint(size int) (uint64, error) {
+	buf := make([]byte, 8)
+	if _, err := io.ReadFull(d.r, buf[8-size:]); err != nil {
+		return 0, errTruncated
+	}
+	return binary.BigEndian.Uint64(buf), nil
+}
+
+// maxPrealloc bounds the room allocated ahead for the strings, arrays and
+// maps, whose length is read from the input and may be bogus: beyond it, they
+// grow as their contents are actually read.
+const maxPrealloc = 1024
+
+func (d *Decoder) str(n int) (string, error) {
+	if n < 0 {
+		return "", errTruncated
+	}
+	var buf bytes.Buffer
+	buf.Grow(prealloc(n))
+	if _, err := io.CopyN(&buf, d.r, int64(n)); err != nil {
+		return "", errTruncated
+	}
+	return buf.String(), nil
+}
+
+func (d *Decoder) array(n int) ([]interface{}, error) {
+	a := make([]interface{}, 0, prealloc(n))
+	for i := 0; i < n; i++ {
+		v, err := d.value()
+		if err != nil {
+			return nil, truncated(err)
+		}
+		a = append(a, v)
+	}
+	return a, nil
+}
+
+func (d *Decoder) m(n int) (map[string]interface{}, error) {
+	m := make(map[string]interface{}, prealloc(n))
+	for i := 0; i < n; i++ {
+		k, err := d.value()
+		if err != nil {
+			return nil, truncated(err)
+		}
+		v, err := d.value()
+		if err != nil {
+			return nil, truncated(err)
+		}
+		m[fmt.Sprint(k)] = v
+	}
+	return m, nil
+}
+
+// prealloc returns the room to allocate ahead for n elements.
+func prealloc(n int) int {
+	if n > maxPrealloc {
+		return maxPrealloc
+	}
+	return n
+}
+
+// truncated turns an EOF in the middle of a record into errTruncated.
+func truncated(err error) error {
+	if err == io.EOF {
+		return errTruncated
+	}
+	return err
+}
@@ -0,0 +1,77 @@
+package msgpack
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pressly/lg"
+	"github.com/sirupsen/logrus"
+)
+
+func TestRoundTrip(t *testing.T) {
+	entry := &logrus.Entry{
+		Time:    time.Date(2018, 8, 21, 14, 8, 42, 0, time.UTC),
+		Level:   logrus.WarnLevel,
+		Message: "request complete",
+		Data: logrus.Fields{
+			"resp_status":     503,
+			"offset":          -5,
+			"resp_bytes":      int64(1 << 40),
+			"resp_elapsed_ms": 12.5,
+			"slow":            true,
+			"user":            nil,
+			"uri":             "/articles/1",
+			"error":           errors.New("upstream timeout"),
+			"tags":            []string{"a", "b"},
+			"http":            logrus.Fields{"method": "GET"},
+		},
+	}
+	var buf bytes.Buffer
+	for i := 0; i < 2; i++ {
+		b, err := (&lg.MsgpackFormatter{}).Format(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(b)
+	}
+
+	want := map[string]interface{}{
+		"time":            "2018-08-21T14:08:42Z",
+		"level":           "warning",
+		"msg":             "request complete",
+		"resp_status":     int64(503),
+		"offset":          int64(-5),
+		"resp_bytes":      int64(1 << 40),
+		"resp_elapsed_ms": 12.5,
+		"slow":            true,
+		"user":            nil,
+		"uri":             "/articles/1",
+		"error":           "upstream timeout",
+		"tags":            []interface{}{"a", "b"},
+		"http":            map[string]interface{}{"method": "GET"},
+	}
+	dec := NewDecoder(&buf)
+	for i := 0; i < 2; i++ {
+		record, err := dec.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(record, want) {
+			t.Errorf("record %d is %#v, want %#v", i, record, want)
+		}
+	}
+	if _, err := dec.Decode(); err == nil {
+		t.Error("no error at the end of the stream")
+	}
+}
+
+func TestDecodeBogusLength(t *testing.T) {
+	// A map whose value claims to be an array of 4G elements.
+	input := []byte{0x81, 0xa1, 'k', 0xdd, 0xff, 0xff, 0xff, 0xff}
+	if _, err := NewDecoder(bytes.NewReader(input)).Decode(); err != errTruncated {
+		t.Errorf("error is %v, want %v", err, errTruncated)
+	}
+}
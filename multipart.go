@@ -0,0 +1,76 @@
+package lg
+
+import (
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+)
+
+// maxMultipartParts is the maximum number of parts of a multipart body
+// logged.
+const maxMultipartParts = 100
+
+// multipartBody records the names, file names and sizes of the parts of a
+// multipart/form-data request body, as the handler reads it. The parts are
+// parsed from a copy of the body in a goroutine, their contents are
+// discarded.
+type multipartBody struct {
+	io.ReadCloser
+	pw    *io.PipeWriter
+	done  chan struct{}
+	parts []map[string]interface{}
+}
+
+// newMultipartBody returns the body of r wrapped to record its parts, or nil
+// if r is not a multipart/form-data request.
+func newMultipartBody(r *http.Request) *multipartBody {
+	mt, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mt != "multipart/form-data" || params["boundary"] == "" {
+		return nil
+	}
+	pr, pw := io.Pipe()
+	b := &multipartBody{ReadCloser: r.Body, pw: pw, done: make(chan struct{})}
+	go b.parse(multipart.NewReader(pr, params["boundary"]), pr)
+	return b
+}
+
+func (b *multipartBody) parse(mr *multipart.Reader, pr *io.PipeReader) {
+	defer close(b.done)
+	// Keep reading the copy of the body whatever happens, so the handler is
+	// never blocked by the pipe.
+	defer io.Copy(ioutil.Discard, pr)
+
+	for len(b.parts) < maxMultipartParts {
+		part, err := mr.NextPart()
+		if err != nil {
+			return
+		}
+		n, _ := io.Copy(ioutil.Discard, part)
+		p := map[string]interface{}{"name": cleanString(part.FormName()), "bytes": n}
+		if filename := part.FileName(); filename != "" {
+			p["filename"] = cleanString(filename)
+		}
+		b.parts = append(b.parts, p)
+	}
+}
+
+func (b *multipartBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.pw.Write(p[:n])
+	}
+	if err != nil {
+		b.pw.CloseWithError(err)
+	}
+	return n, err
+}
+
+// finish stops the parsing of the body and returns the parts read by the
+// handler.
+func (b *multipartBody) finish() []map[string]interface{} {
+	b.pw.Close()
+	<-b.done
+	return b.parts
+}
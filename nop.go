@@ -0,0 +1,27 @@
+package lg
+
+import (
+	"context"
+	"io/ioutil"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Discard returns a logger discarding its lines, for tests and the libraries
+// which don't care about logging. Its Fatal and Panic lines still exit and
+// panic, as with any logrus logger.
+func Discard() *logrus.Logger {
+	return &logrus.Logger{
+		Out:       ioutil.Discard,
+		Formatter: discardFormatter{},
+		Hooks:     logrus.LevelHooks{},
+		Level:     logrus.PanicLevel,
+	}
+}
+
+// NewNopContext returns a context with a Discard logger, on which Log(ctx),
+// SetEntryField and the other functions of lg taking a context are valid
+// and log nothing, to call code instrumented with lg from tests.
+func NewNopContext() context.Context {
+	return WithLoggerContext(context.Background(), Discard())
+}
@@ -0,0 +1,412 @@
+package lg
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Option sets a setting of the request logger, see RequestLogger.
+type Option func(*RequestLoggerConfig)
+
+// WithConfig replaces the settings with the given config. Options given after
+// it still apply.
+func WithConfig(config RequestLoggerConfig) Option {
+	return func(c *RequestLoggerConfig) {
+		*c = config
+	}
+}
+
+// WithRequestID generates a request id for requests which don't have one.
+func WithRequestID() Option {
+	return func(c *RequestLoggerConfig) {
+		c.RequestID = true
+	}
+}
+
+// WithSkipPaths only logs warnings and errors for the given request paths.
+func WithSkipPaths(paths ...string) Option {
+	return func(c *RequestLoggerConfig) {
+		c.SkipPaths = append(c.SkipPaths, paths...)
+	}
+}
+
+// WithSampleRate logs the info and debug lines of a fraction of the requests.
+func WithSampleRate(rate float64) Option {
+	return func(c *RequestLoggerConfig) {
+		c.SampleRate = rate
+	}
+}
+
+// WithTrustedRequestID derives the sampling decision from the request ids
+// received in the X-Request-Id header, see RequestLoggerConfig.TrustRequestID.
+func WithTrustedRequestID() Option {
+	return func(c *RequestLoggerConfig) {
+		c.TrustRequestID = true
+	}
+}
+
+// WithSlowThreshold flags and warns about requests slower than d.
+func WithSlowThreshold(d time.Duration) Option {
+	return func(c *RequestLoggerConfig) {
+		c.SlowThreshold = d
+	}
+}
+
+// WithLevelForStatus sets the level of the completion line by status.
+func WithLevelForStatus(fn func(status int) logrus.Level) Option {
+	return func(c *RequestLoggerConfig) {
+		c.LevelForStatus = fn
+	}
+}
+
+// WithOnComplete adds a hook called after a request has been logged. Hooks
+// given by multiple options are called in order.
+func WithOnComplete(fn func(r *http.Request, status, bytes int, elapsed time.Duration, fields logrus.Fields)) Option {
+	return func(c *RequestLoggerConfig) {
+		prev := c.OnComplete
+		if prev == nil {
+			c.OnComplete = fn
+			return
+		}
+		c.OnComplete = func(r *http.Request, status, bytes int, elapsed time.Duration, fields logrus.Fields) {
+			prev(r, status, bytes, elapsed, fields)
+			fn(r, status, bytes, elapsed, fields)
+		}
+	}
+}
+
+// WithBeforeWrite appends hooks to the BeforeWrite chain.
+func WithBeforeWrite(fns ...BeforeWriteFunc) Option {
+	return func(c *RequestLoggerConfig) {
+		c.BeforeWrite = append(c.BeforeWrite, fns...)
+	}
+}
+
+// WithFilter sets the filter of the lines written by the request logger.
+func WithFilter(fn func(level logrus.Level, msg string, fields logrus.Fields) bool) Option {
+	return func(c *RequestLoggerConfig) {
+		c.Filter = fn
+	}
+}
+
+// WithMaxFieldLength truncates field values longer than n.
+func WithMaxFieldLength(n int) Option {
+	return func(c *RequestLoggerConfig) {
+		c.MaxFieldLength = n
+	}
+}
+
+// WithMaxEntrySize truncates the largest fields of entries larger than n.
+func WithMaxEntrySize(n int) Option {
+	return func(c *RequestLoggerConfig) {
+		c.MaxEntrySize = n
+	}
+}
+
+// WithRedactSecrets masks the values matching SecretPatterns.
+func WithRedactSecrets() Option {
+	return func(c *RequestLoggerConfig) {
+		c.RedactSecrets = true
+	}
+}
+
+// WithFieldPolicy tags field keys and sets the policy applied to them.
+func WithFieldPolicy(tags map[string]FieldTag, policy FieldPolicy) Option {
+	return func(c *RequestLoggerConfig) {
+		c.FieldTags = tags
+		c.FieldPolicy = policy
+	}
+}
+
+// WithSanitizeRules replaces the values of query parameters in the logged uri.
+func WithSanitizeRules(rules map[string]string) Option {
+	return func(c *RequestLoggerConfig) {
+		c.SanitizeRules = rules
+	}
+}
+
+// WithConfigWatcher applies the settings of the config file watched by w on
+// top of the other settings, as soon as the file changes.
+func WithConfigWatcher(w *ConfigWatcher) Option {
+	return func(c *RequestLoggerConfig) {
+		c.watcher = w
+	}
+}
+
+// WithCacheHeaders captures the caching related response headers.
+func WithCacheHeaders() Option {
+	return func(c *RequestLoggerConfig) {
+		c.CacheHeaders = true
+	}
+}
+
+// WithContentHeaders logs the content type and encoding of the responses.
+func WithContentHeaders() Option {
+	return func(c *RequestLoggerConfig) {
+		c.ContentHeaders = true
+	}
+}
+
+// WithRangeFields logs the byte ranges of the Range requests.
+func WithRangeFields() Option {
+	return func(c *RequestLoggerConfig) {
+		c.RangeFields = true
+	}
+}
+
+// WithBotDetector tags, samples or skips the requests of bots.
+func WithBotDetector(d *BotDetector) Option {
+	return func(c *RequestLoggerConfig) {
+		c.Bots = d
+	}
+}
+
+// WithSkipMethods only logs warnings and errors for the given methods.
+func WithSkipMethods(methods ...string) Option {
+	return func(c *RequestLoggerConfig) {
+		c.SkipMethods = append(c.SkipMethods, methods...)
+	}
+}
+
+// WithDemoteMethods logs the requests of the given methods at the debug level.
+func WithDemoteMethods(methods ...string) Option {
+	return func(c *RequestLoggerConfig) {
+		c.DemoteMethods = append(c.DemoteMethods, methods...)
+	}
+}
+
+// WithSkipExtensions skips the requests for files with the given extensions.
+func WithSkipExtensions(extensions ...string) Option {
+	return func(c *RequestLoggerConfig) {
+		c.SkipExtensions = append(c.SkipExtensions, extensions...)
+	}
+}
+
+// WithDemoteExtensions logs the requests for files with the given extensions
+// at the debug level.
+func WithDemoteExtensions(extensions ...string) Option {
+	return func(c *RequestLoggerConfig) {
+		c.DemoteExtensions = append(c.DemoteExtensions, extensions...)
+	}
+}
+
+// WithSkipPreflight skips the successful CORS preflight requests.
+func WithSkipPreflight() Option {
+	return func(c *RequestLoggerConfig) {
+		c.SkipPreflight = true
+	}
+}
+
+// WithSecurityDetector writes security events for suspicious requests.
+func WithSecurityDetector(d *SecurityDetector) Option {
+	return func(c *RequestLoggerConfig) {
+		c.Security = d
+	}
+}
+
+// WithAdaptiveSampler adapts the sampling rate to the request rate.
+func WithAdaptiveSampler(s *AdaptiveSampler) Option {
+	return func(c *RequestLoggerConfig) {
+		c.Sampler = s
+	}
+}
+
+// WithDurationBuckets adds a latency bucket field to the completion line.
+func WithDurationBuckets(buckets ...time.Duration) Option {
+	return func(c *RequestLoggerConfig) {
+		c.DurationBuckets = buckets
+	}
+}
+
+// WithOperationID logs the OpenAPI operationId of the requests.
+func WithOperationID(fn func(r *http.Request) string) Option {
+	return func(c *RequestLoggerConfig) {
+		c.OperationID = fn
+	}
+}
+
+// WithBodyKeys logs the top-level keys of the JSON request bodies.
+func WithBodyKeys() Option {
+	return func(c *RequestLoggerConfig) {
+		c.BodyKeys = true
+	}
+}
+
+// WithIsError classifies the requests as SLO errors or not.
+func WithIsError(fn func(status int, r *http.Request, err error) bool) Option {
+	return func(c *RequestLoggerConfig) {
+		c.IsError = fn
+	}
+}
+
+// WithOnServerError sets the hook called for the 5xx and panic completions.
+func WithOnServerError(fn func(entry *HTTPLoggerEntry, status int)) Option {
+	return func(c *RequestLoggerConfig) {
+		c.OnServerError = fn
+	}
+}
+
+// WithLatencyBaseline flags the requests much slower than their route's p95.
+func WithLatencyBaseline(b *LatencyBaseline) Option {
+	return func(c *RequestLoggerConfig) {
+		c.LatencyBaseline = b
+	}
+}
+
+// WithInformationalResponses passes the 1xx responses through and logs them.
+func WithInformationalResponses() Option {
+	return func(c *RequestLoggerConfig) {
+		c.InformationalResponses = true
+	}
+}
+
+// WithTrailerFields logs the given response trailers.
+func WithTrailerFields(names ...string) Option {
+	return func(c *RequestLoggerConfig) {
+		c.TrailerFields = names
+	}
+}
+
+// WithMaxPanicsPerMinute crashes the process after too many panics.
+func WithMaxPanicsPerMinute(n int) Option {
+	return func(c *RequestLoggerConfig) {
+		c.MaxPanicsPerMinute = n
+	}
+}
+
+// WithRepanic leaves the recovery of the panics to a Recoverer.
+func WithRepanic() Option {
+	return func(c *RequestLoggerConfig) {
+		c.Repanic = true
+	}
+}
+
+// WithInterceptFatal makes the fatal lines of the requests abort the request.
+func WithInterceptFatal() Option {
+	return func(c *RequestLoggerConfig) {
+		c.InterceptFatal = true
+	}
+}
+
+// WithRequestBytes logs the number of bytes of the request bodies.
+func WithRequestBytes() Option {
+	return func(c *RequestLoggerConfig) {
+		c.RequestBytes = true
+	}
+}
+
+// WithUploadProgress logs the progress of the uploads at the given interval.
+func WithUploadProgress(interval time.Duration) Option {
+	return func(c *RequestLoggerConfig) {
+		c.UploadProgressInterval = interval
+	}
+}
+
+// WithMultipartParts logs the parts of the multipart requests.
+func WithMultipartParts() Option {
+	return func(c *RequestLoggerConfig) {
+		c.MultipartParts = true
+	}
+}
+
+// WithContextFields logs values of the request context on completion.
+func WithContextFields(fields ...ContextField) Option {
+	return func(c *RequestLoggerConfig) {
+		c.ContextFields = append(c.ContextFields, fields...)
+	}
+}
+
+// WithGoroutineDiagnostics logs the goroutine id and number of goroutines.
+func WithGoroutineDiagnostics() Option {
+	return func(c *RequestLoggerConfig) {
+		c.GoroutineDiagnostics = true
+	}
+}
+
+// WithStartedLineDelay writes the started line only for the long requests.
+func WithStartedLineDelay(d time.Duration) Option {
+	return func(c *RequestLoggerConfig) {
+		c.StartedLineDelay = d
+	}
+}
+
+// WithTrackInFlight tracks the requests in flight for LogAbortedRequests.
+func WithTrackInFlight() Option {
+	return func(c *RequestLoggerConfig) {
+		c.TrackInFlight = true
+	}
+}
+
+// WithStartEndTimestamps adds the ts_start and ts_end fields to the
+// completion lines.
+func WithStartEndTimestamps() Option {
+	return func(c *RequestLoggerConfig) {
+		c.StartEndTimestamps = true
+	}
+}
+
+// WithStatusPolicy sets the logging policy of the completion lines of a
+// response status, such as http.StatusNotFound.
+func WithStatusPolicy(status int, policy StatusPolicy) Option {
+	return func(c *RequestLoggerConfig) {
+		if c.StatusPolicies == nil {
+			c.StatusPolicies = map[int]StatusPolicy{}
+		}
+		c.StatusPolicies[status] = policy
+	}
+}
+
+// WithSubtaskRollup lists the subtasks of the requests on their completion
+// lines.
+func WithSubtaskRollup() Option {
+	return func(c *RequestLoggerConfig) {
+		c.SubtaskRollup = true
+	}
+}
+
+// WithServerTiming sets the Server-Timing header of the responses.
+func WithServerTiming() Option {
+	return func(c *RequestLoggerConfig) {
+		c.ServerTiming = true
+	}
+}
+
+// WithStatusAssertions logs a warning when a handler misuses the status of
+// the response.
+func WithStatusAssertions() Option {
+	return func(c *RequestLoggerConfig) {
+		c.StatusAssertions = true
+	}
+}
+
+// WithWriteErrors records the errors writing the response bodies.
+func WithWriteErrors() Option {
+	return func(c *RequestLoggerConfig) {
+		c.WriteErrors = true
+	}
+}
+
+// WithDumpDir dumps the requests which failed with a 5xx or a panic to dir.
+func WithDumpDir(dir string) Option {
+	return func(c *RequestLoggerConfig) {
+		c.DumpDir = dir
+	}
+}
+
+// WithResponseHeaders captures the given response headers on the completion
+// lines, such as "Location", "Retry-After" and "X-RateLimit-*".
+func WithResponseHeaders(names ...string) Option {
+	return func(c *RequestLoggerConfig) {
+		c.ResponseHeaders = append(c.ResponseHeaders, names...)
+	}
+}
+
+// WithFieldProvenance records where the fields of the request entries are
+// set.
+func WithFieldProvenance() Option {
+	return func(c *RequestLoggerConfig) {
+		c.FieldProvenance = true
+	}
+}
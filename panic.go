@@ -0,0 +1,101 @@
+package lg
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// panicGroupFrames is the number of stack frames hashed into the panic group.
+const panicGroupFrames = 5
+
+// panicGroup returns a stable key for a panic, hashed from the function names
+// of the top frames of its stack trace, leaving out the frames of the runtime
+// and of lg. Identical panics get the same key across instances and deploys,
+// even when their messages contain variable data.
+func panicGroup(stack []byte) string {
+	h := sha1.New()
+	n := 0
+	for _, line := range bytes.Split(stack, []byte{'\n'}) {
+		if len(line) == 0 || line[0] == '\t' || bytes.HasPrefix(line, []byte("goroutine ")) {
+			continue
+		}
+		fn := string(line)
+		if i := strings.LastIndexByte(fn, '('); i > 0 {
+			fn = fn[:i]
+		}
+		if fn == "panic" || strings.HasPrefix(fn, "runtime.") || strings.HasPrefix(fn, "runtime/debug.") ||
+			strings.HasPrefix(fn, "github.com/pressly/lg.") {
+			continue
+		}
+		h.Write([]byte(fn))
+		h.Write([]byte{'\n'})
+		if n++; n == panicGroupFrames {
+			break
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// fmtPanic formats the value of a recovered panic.
+func fmtPanic(rec interface{}) string {
+	return fmt.Sprintf("%+v", rec)
+}
+
+// panics counts the recovered panics per route, and over the current minute
+// for the fail-fast mode of the request logger.
+var panics = struct {
+	sync.Mutex
+	byRoute map[string]uint64
+	window  time.Time
+	count   int
+}{byRoute: map[string]uint64{}}
+
+// exit is called by the fail-fast mode to crash the process, after the
+// handlers registered with logrus.RegisterExitHandler, such as the cleanup of
+// Setup, flushed the logs.
+var exit = logrus.Exit
+
+// countPanic records the panic rec of r, and returns the number of panics
+// recovered over the current minute. The panics aborting the requests which
+// logged an intercepted fatal line aren't counted, and return 0, see
+// InterceptFatal.
+func countPanic(r *http.Request, rec interface{}) int {
+	if _, ok := rec.(*fatalError); ok {
+		return 0
+	}
+	atomic.AddUint64(&counters.PanicsRecovered, 1)
+	route := routePattern(r)
+	if route == "" {
+		route = "unmatched"
+	}
+	now := time.Now()
+
+	panics.Lock()
+	defer panics.Unlock()
+	panics.byRoute[r.Method+" "+route]++
+	if now.Sub(panics.window) >= time.Minute {
+		panics.window, panics.count = now, 0
+	}
+	panics.count++
+	return panics.count
+}
+
+// panicsByRoute returns a copy of the number of panics per route.
+func panicsByRoute() map[string]uint64 {
+	panics.Lock()
+	defer panics.Unlock()
+	m := make(map[string]uint64, len(panics.byRoute))
+	for k, v := range panics.byRoute {
+		m[k] = v
+	}
+	return m
+}
@@ -0,0 +1,64 @@
+package lg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FieldTag classifies a field for the field policies.
+type FieldTag string
+
+const (
+	TagPII      FieldTag = "pii"
+	TagDebug    FieldTag = "debug"
+	TagInternal FieldTag = "internal"
+)
+
+// FieldAction is what a field policy does with a tagged field.
+type FieldAction int
+
+const (
+	FieldEmit FieldAction = iota
+	FieldHash
+	FieldDrop
+)
+
+// FieldPolicy maps field tags to the action applied to the fields carrying
+// them. Tags which are not in the policy are emitted.
+type FieldPolicy map[FieldTag]FieldAction
+
+// Policies for the usual environments: everything is logged in development,
+// personal data is hashed in staging, and in production personal data is
+// hashed while debug and internal fields are dropped.
+var (
+	DevPolicy     = FieldPolicy{}
+	StagingPolicy = FieldPolicy{TagPII: FieldHash}
+	ProdPolicy    = FieldPolicy{TagPII: FieldHash, TagDebug: FieldDrop, TagInternal: FieldDrop}
+)
+
+// apply runs the policy over fields, given the tags of the field keys.
+func (p FieldPolicy) apply(fields logrus.Fields, tags map[string]FieldTag) logrus.Fields {
+	for k, tag := range tags {
+		v, ok := fields[k]
+		if !ok {
+			continue
+		}
+		switch p[tag] {
+		case FieldHash:
+			fields[k] = hashValue(v)
+		case FieldDrop:
+			delete(fields, k)
+		}
+	}
+	return fields
+}
+
+// hashValue returns a short, stable hash of v, so equal values can still be
+// correlated without being readable.
+func hashValue(v interface{}) string {
+	sum := sha256.Sum256([]byte(fmt.Sprint(v)))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
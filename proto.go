@@ -0,0 +1,43 @@
+package lg
+
+import (
+	"net/http"
+	"reflect"
+)
+
+// httpProto returns the protocol of r for the http_proto field: h2 and h2c
+// for HTTP/2 over TLS and cleartext, h3 for HTTP/3, such as served by
+// quic-go, and the protocol of the request line, such as HTTP/1.1, otherwise.
+func httpProto(r *http.Request) string {
+	switch r.ProtoMajor {
+	case 2:
+		if r.TLS == nil {
+			return "h2c"
+		}
+		return "h2"
+	case 3:
+		return "h3"
+	}
+	return r.Proto
+}
+
+// streamID returns the id of the stream of r, when its body exposes it with
+// a StreamID method, as the request bodies of quic-go do, or -1. The id is
+// found by reflection, as its type belongs to the server package. The HTTP/2
+// server of net/http doesn't expose the id of its streams.
+func streamID(r *http.Request) int64 {
+	if r.Body == nil {
+		return -1
+	}
+	m := reflect.ValueOf(r.Body).MethodByName("StreamID")
+	if !m.IsValid() || m.Type().NumIn() != 0 || m.Type().NumOut() != 1 {
+		return -1
+	}
+	switch out := m.Call(nil)[0]; out.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return out.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(out.Uint())
+	}
+	return -1
+}
@@ -0,0 +1,114 @@
+package lg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ProtobufFormatter formats the entries as length-prefixed protobuf records of
+// the Entry message of entry.proto, for pipelines which want compact and
+// schema-checked logs instead of JSON. Integer, float and bool fields keep
+// their type, other fields are formatted as strings.
+type ProtobufFormatter struct{}
+
+// Wire types and field numbers of entry.proto.
+const (
+	pbVarint  = 0
+	pbFixed64 = 1
+	pbBytes   = 2
+
+	pbEntryTime    = 1
+	pbEntryLevel   = 2
+	pbEntryMessage = 3
+	pbEntryFields  = 4
+
+	pbValueString = 1
+	pbValueNumber = 2
+	pbValueInt    = 3
+	pbValueBool   = 4
+)
+
+func (f *ProtobufFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	var msg []byte
+	msg = pbAppendVarintField(msg, pbEntryTime, uint64(entry.Time.UnixNano()))
+	msg = pbAppendBytesField(msg, pbEntryLevel, []byte(entry.Level.String()))
+	msg = pbAppendBytesField(msg, pbEntryMessage, []byte(entry.Message))
+
+	// Sorted, so that the same entry is always encoded the same way.
+	keys := make([]string, 0, len(entry.Data))
+	for k := range entry.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var kv []byte
+		kv = pbAppendBytesField(kv, 1, []byte(k))
+		kv = pbAppendBytesField(kv, 2, pbValue(entry.Data[k]))
+		msg = pbAppendBytesField(msg, pbEntryFields, kv)
+	}
+
+	b := make([]byte, 0, len(msg)+binary.MaxVarintLen64)
+	b = pbAppendVarint(b, uint64(len(msg)))
+	return append(b, msg...), nil
+}
+
+// pbValue encodes v as a Value message.
+func pbValue(v interface{}) []byte {
+	var b []byte
+	switch v := v.(type) {
+	case bool:
+		n := uint64(0)
+		if v {
+			n = 1
+		}
+		return pbAppendVarintField(b, pbValueBool, n)
+	case int:
+		return pbAppendVarintField(b, pbValueInt, uint64(v))
+	case int32:
+		return pbAppendVarintField(b, pbValueInt, uint64(v))
+	case int64:
+		return pbAppendVarintField(b, pbValueInt, uint64(v))
+	case uint32:
+		return pbAppendVarintField(b, pbValueInt, uint64(v))
+	case float32:
+		return pbAppendFixed64Field(b, pbValueNumber, math.Float64bits(float64(v)))
+	case float64:
+		return pbAppendFixed64Field(b, pbValueNumber, math.Float64bits(v))
+	case error:
+		return pbAppendBytesField(b, pbValueString, []byte(v.Error()))
+	case string:
+		return pbAppendBytesField(b, pbValueString, []byte(v))
+	default:
+		return pbAppendBytesField(b, pbValueString, []byte(fmt.Sprintf("%+v", v)))
+	}
+}
+
+func pbAppendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func pbAppendVarintField(b []byte, num int, v uint64) []byte {
+	b = pbAppendVarint(b, uint64(num)<<3|pbVarint)
+	return pbAppendVarint(b, v)
+}
+
+func pbAppendFixed64Field(b []byte, num int, v uint64) []byte {
+	b = pbAppendVarint(b, uint64(num)<<3|pbFixed64)
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func pbAppendBytesField(b []byte, num int, v []byte) []byte {
+	b = pbAppendVarint(b, uint64(num)<<3|pbBytes)
+	b = pbAppendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
@@ -0,0 +1,69 @@
+package lg
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+
+	"github.com/sirupsen/logrus"
+)
+
+// provenanceSkip are the functions of lg setting the fields of an entry on
+// behalf of their caller, skipped when recording where a field was set.
+var provenanceSkip = map[string]bool{
+	"lg.(*HTTPLoggerEntry).AddFields":           true,
+	"lg.(*HTTPLoggerEntry).addCompletionFields": true,
+	"lg.SetCompletionField":                     true,
+	"lg.SetEntryField":                          true,
+	"lg.SetEntryFields":                         true,
+	"lg.SetRequestEntryField":                   true,
+	"lg.SetRequestEntryFields":                  true,
+}
+
+// fieldSetter returns the function and the file and line setting fields on
+// an entry, such as "main.TenantCtx.func1 main.go:42", from the caller of
+// recordProvenance.
+func fieldSetter() string {
+	pcs := make([]uintptr, 16)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		name := funcNameOf(frame.Function)
+		if !provenanceSkip[name] {
+			return fmt.Sprintf("%s %s:%d", name, filepath.Base(frame.File), frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// recordProvenance records where the given fields were set on the entry,
+// with FieldProvenance.
+func (l *HTTPLoggerEntry) recordProvenance(fields logrus.Fields) {
+	setter := fieldSetter()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.provenance == nil {
+		l.provenance = map[string]string{}
+	}
+	for k := range fields {
+		l.provenance[k] = setter
+	}
+}
+
+// provenanceFields returns the fields_set_by field of the entry, mapping the
+// fields set during the request to where they were set last.
+func (l *HTTPLoggerEntry) provenanceFields() logrus.Fields {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.provenance) == 0 {
+		return nil
+	}
+	setBy := make(map[string]string, len(l.provenance))
+	for k, v := range l.provenance {
+		setBy[k] = v
+	}
+	return logrus.Fields{"fields_set_by": setBy}
+}
@@ -0,0 +1,69 @@
+package lg
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// InstrumentProxy records the upstream of the requests forwarded by a reverse
+// proxy on their request entry: upstream_target, upstream_status,
+// upstream_ms, upstream_attempts and upstream_error. The existing transport
+// and error handler of the proxy are kept.
+func InstrumentProxy(p *httputil.ReverseProxy) {
+	p.Transport = ProxyTransport(p.Transport)
+	p.ErrorHandler = ProxyErrorHandler(p.ErrorHandler)
+}
+
+// ProxyTransport wraps the transport of a reverse proxy, nil meaning
+// http.DefaultTransport, to record the upstream target, status and latency of
+// each attempt on the request entry.
+func ProxyTransport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &proxyTransport{next}
+}
+
+type proxyTransport struct {
+	next http.RoundTripper
+}
+
+func (t *proxyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	attempts := 1
+	if entry, ok := GetLogEntry(req.Context()); ok {
+		if n, ok := entry.fields()["upstream_attempts"].(int); ok {
+			attempts = n + 1
+		}
+	}
+
+	t1 := time.Now()
+	resp, err := t.next.RoundTrip(req)
+
+	fields := logrus.Fields{
+		"upstream_target":   req.URL.Host,
+		"upstream_ms":       float64(time.Since(t1).Nanoseconds()) / 1000000.0,
+		"upstream_attempts": attempts,
+	}
+	if resp != nil {
+		fields["upstream_status"] = resp.StatusCode
+	}
+	SetEntryFields(req.Context(), fields)
+	return resp, err
+}
+
+// ProxyErrorHandler wraps the error handler of a reverse proxy to record the
+// upstream error on the request entry. A nil handler responds with a 502, the
+// same as the reverse proxy does by default.
+func ProxyErrorHandler(next func(http.ResponseWriter, *http.Request, error)) func(http.ResponseWriter, *http.Request, error) {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		SetEntryField(r.Context(), "upstream_error", err.Error())
+		if next != nil {
+			next(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}
+}
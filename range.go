@@ -0,0 +1,41 @@
+package lg
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// rangeFields returns the fields of the Range request r and of its response
+// status: range_start and range_end of its first range, when set,
+// range_count when it has multiple ranges, and range_partial when a 206
+// Partial Content was served.
+func rangeFields(r *http.Request, status int) logrus.Fields {
+	spec := r.Header.Get("Range")
+	if !strings.HasPrefix(spec, "bytes=") {
+		return nil
+	}
+	ranges := strings.Split(strings.TrimPrefix(spec, "bytes="), ",")
+	fields := logrus.Fields{"range_partial": status == http.StatusPartialContent}
+	if len(ranges) > 1 {
+		fields["range_count"] = len(ranges)
+	}
+	bounds := strings.SplitN(strings.TrimSpace(ranges[0]), "-", 2)
+	if len(bounds) != 2 {
+		return fields
+	}
+	if start, err := strconv.ParseInt(bounds[0], 10, 64); err == nil {
+		fields["range_start"] = start
+	}
+	if end, err := strconv.ParseInt(bounds[1], 10, 64); err == nil {
+		if bounds[0] == "" {
+			// A suffix range, for the last bytes of the content.
+			fields["range_suffix_length"] = end
+		} else {
+			fields["range_end"] = end
+		}
+	}
+	return fields
+}
@@ -0,0 +1,78 @@
+package lg
+
+import (
+	"context"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Recoverer is a middleware recovering from the panics of the handlers and
+// responding with a 500, separately from the request logger which otherwise
+// recovers them itself. Installed after the request logger, the panics are
+// recorded on the request entry. Installed before it, or without it, they're
+// logged with the logger of the context, or DefaultLogger; use WithRepanic on
+// the request logger so that it writes the entry and leaves the recovery to
+// the Recoverer, which then doesn't log the panics again. The
+// MaxPanicsPerMinute option applies.
+func Recoverer(opts ...Option) func(next http.Handler) http.Handler {
+	var config RequestLoggerConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rp := &recoveredPanic{}
+			r = r.WithContext(context.WithValue(r.Context(), recovererCtxKey, rp))
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+				if rec == http.ErrAbortHandler {
+					// The handler aborted the response on purpose.
+					panic(rec)
+				}
+				stack := debug.Stack()
+				recent := countPanic(r, rec)
+
+				logger := loggerOrDefault(r.Context())
+				if entry, ok := GetLogEntry(r.Context()); ok {
+					entry.Panic(rec, stack)
+					logger = entry.lineLogger()
+				} else if !rp.logged {
+					// Unless written by the request logger, with WithRepanic.
+					logger.WithFields(logrus.Fields{
+						"stack":       string(stack),
+						"panic":       cleanString(fmtPanic(rec)),
+						"panic_group": panicGroup(stack),
+					}).Errorln("panic recovered")
+				}
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+
+				if config.MaxPanicsPerMinute > 0 && recent > config.MaxPanicsPerMinute {
+					logger.WithField("panics_per_minute", recent).Errorln("too many panics, exiting")
+					exit(2)
+				}
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+var recovererCtxKey = &contextKey{"Recoverer"}
+
+// recoveredPanic is set in the context by a Recoverer, for the request logger
+// to flag the panics it logged before repanicking, with WithRepanic.
+type recoveredPanic struct {
+	logged bool
+}
+
+// markPanicLogged flags the panic of r as logged, for the Recoverer before the
+// request logger.
+func markPanicLogged(r *http.Request) {
+	if rp, ok := r.Context().Value(recovererCtxKey).(*recoveredPanic); ok {
+		rp.logged = true
+	}
+}
@@ -2,14 +2,26 @@ package lg
 
 import (
 	stdlog "log"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 )
 
-func RedirectStdlogOutput(logger *logrus.Logger) {
+// RedirectStdlogOutput redirects the output of the standard library logger to
+// logger. It returns a func restoring the previous output and flags of the
+// standard logger, to scope the redirection in tests. The prefix of the
+// standard logger is kept.
+func RedirectStdlogOutput(logger *logrus.Logger) (restore func()) {
+	out, flags := stdlog.Writer(), stdlog.Flags()
+
 	// Redirect standard logger
 	stdlog.SetOutput(&logRedirectWriter{logger})
 	stdlog.SetFlags(0)
+
+	return func() {
+		stdlog.SetOutput(out)
+		stdlog.SetFlags(flags)
+	}
 }
 
 // Proxy writer for any packages using the standard log.Println() stuff
@@ -17,9 +29,29 @@ type logRedirectWriter struct {
 	Logger *logrus.Logger
 }
 
+// Write logs the line written by the standard logger, parsed by the first of
+// StdlogParsers which recognizes it. The lines after the first one of a
+// multi-line write, such as a stack trace, are logged in the lines field of
+// the entry.
 func (l *logRedirectWriter) Write(p []byte) (n int, err error) {
-	if len(p) > 0 {
-		l.Logger.Infof("%s", p[:len(p)-1])
+	if len(p) == 0 {
+		return 0, nil
+	}
+	lines := strings.Split(strings.TrimRight(string(p), "\r\n"), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSuffix(lines[i], "\r")
+	}
+
+	entry := logrus.NewEntry(l.Logger)
+	if len(lines) > 1 {
+		entry = entry.WithField("lines", lines[1:])
+	}
+	for _, parse := range StdlogParsers {
+		if level, msg, fields, ok := parse(lines[0]); ok {
+			logAtLevel(entry.WithFields(fields), level, msg)
+			return len(p), nil
+		}
 	}
+	entry.Infof("%s", lines[0])
 	return len(p), nil
 }
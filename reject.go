@@ -0,0 +1,122 @@
+package lg
+
+import (
+	"bytes"
+	"io"
+	stdlog "log"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RejectionListener wraps the listener of an http.Server to log the requests
+// rejected by the server before they reach the handlers, and the request
+// logger: malformed requests, missing or invalid Host header, oversized
+// headers, unsupported transfer encodings, which are typical of request
+// smuggling attempts and scanners. They're logged at the warning level with
+// remote_addr, resp_status and reject_reason:
+//
+//	l, _ := net.Listen("tcp", ":8080")
+//	srv.Serve(lg.RejectionListener(l, logger))
+//
+// It inspects the plain HTTP/1 responses, so it must wrap the listener of the
+// server behind a TLS terminating proxy, not a TLS listener.
+func RejectionListener(l net.Listener, logger *logrus.Logger) net.Listener {
+	return &rejectionListener{l, logger}
+}
+
+type rejectionListener struct {
+	net.Listener
+	logger *logrus.Logger
+}
+
+func (l *rejectionListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &rejectionConn{Conn: conn, logger: l.logger}, nil
+}
+
+// rejectionConn inspects the responses written on the connection: net/http
+// writes a rejection in one call, and it may follow the responses of earlier
+// requests on a keep-alive connection.
+type rejectionConn struct {
+	net.Conn
+	logger *logrus.Logger
+}
+
+// rejectionHeaders are the headers of the responses written by net/http for
+// the requests it rejects, as opposed to the responses of handlers, which
+// always have a Date header.
+const rejectionHeaders = "\r\nContent-Type: text/plain; charset=utf-8\r\nConnection: close\r\n\r\n"
+
+var rejectionStatusPrefix = []byte("HTTP/1.1 ")
+
+var rejectionStatusLine = regexp.MustCompile(`^HTTP/1\.1 (\d{3}) [^\r\n]*$`)
+
+func (c *rejectionConn) Write(p []byte) (int, error) {
+	if bytes.HasPrefix(p, rejectionStatusPrefix) {
+		c.inspect(p)
+	}
+	return c.Conn.Write(p)
+}
+
+// ReadFrom writes the body of a response, which is never a rejection.
+func (c *rejectionConn) ReadFrom(r io.Reader) (int64, error) {
+	if rf, ok := c.Conn.(io.ReaderFrom); ok {
+		return rf.ReadFrom(r)
+	}
+	return io.Copy(c.Conn, r)
+}
+
+func (c *rejectionConn) inspect(p []byte) {
+	i := bytes.Index(p, []byte(rejectionHeaders))
+	if i < 0 {
+		return
+	}
+	m := rejectionStatusLine.FindSubmatch(p[:i])
+	if m == nil {
+		return
+	}
+	status, _ := strconv.Atoi(string(m[1]))
+	if status < 400 {
+		return
+	}
+	reason := string(p[i+len(rejectionHeaders):])
+	if j := strings.Index(reason, ": "); j >= 0 && strings.HasPrefix(reason, string(m[1])) {
+		reason = reason[j+2:]
+	}
+	c.logger.WithFields(logrus.Fields{
+		"remote_addr":   c.RemoteAddr().String(),
+		"resp_status":   status,
+		"reject_reason": cleanString(reason),
+	}).Warnln("request rejected")
+}
+
+// ServerErrorLog returns a logger for http.Server.ErrorLog, which writes the
+// errors of the server, such as TLS handshake errors or the panics of
+// handlers outside of the request logger, to logger at the warning level,
+// with their remote_addr when known.
+func ServerErrorLog(logger *logrus.Logger) *stdlog.Logger {
+	return stdlog.New(&serverErrorWriter{logger}, "", 0)
+}
+
+type serverErrorWriter struct {
+	logger *logrus.Logger
+}
+
+var serverErrorAddr = regexp.MustCompile(` from ([^\s]+?):? `)
+
+func (w *serverErrorWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+	entry := w.logger.WithField("server_error", true)
+	if m := serverErrorAddr.FindStringSubmatch(msg + " "); m != nil {
+		entry = entry.WithField("remote_addr", m[1])
+	}
+	entry.Warnln(cleanString(msg))
+	return len(p), nil
+}
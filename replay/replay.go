@@ -0,0 +1,108 @@
+// Package replay re-issues the failed requests dumped by the request logger
+// of lg with DumpDir against a local server, with their original request id
+// in the X-Request-Id header, to reproduce production failures locally:
+//
+//	resp, err := replay.File(ctx, nil, "http://localhost:3333", "dumps/host-abc-000042.http")
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Load reads a request dump.
+func Load(path string) (*http.Request, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	req, err := http.ReadRequest(bufio.NewReader(f))
+	if err != nil {
+		return nil, fmt.Errorf("replay: %s: %v", path, err)
+	}
+	// Read the body now, the file is closed on return.
+	body, err := readBody(req)
+	if err != nil {
+		return nil, fmt.Errorf("replay: %s: %v", path, err)
+	}
+	req.Body = body
+	return req, nil
+}
+
+// File replays the request dumped at path against the server at target, such
+// as "http://localhost:3333", with client, or http.DefaultClient when nil. The
+// caller must close the body of the response.
+func File(ctx context.Context, client *http.Client, target, path string) (*http.Response, error) {
+	req, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return Do(ctx, client, target, req)
+}
+
+// Do sends a request loaded with Load to the server at target.
+func Do(ctx context.Context, client *http.Client, target string, req *http.Request) (*http.Response, error) {
+	base, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	u := *req.URL
+	u.Scheme, u.Host = base.Scheme, base.Host
+	if base.Path != "" && base.Path != "/" {
+		u.Path = base.Path + u.Path
+	}
+
+	out, err := http.NewRequestWithContext(ctx, req.Method, u.String(), req.Body)
+	if err != nil {
+		return nil, err
+	}
+	out.Header = req.Header.Clone()
+	out.Host = req.Host
+	out.ContentLength = req.ContentLength
+	return client.Do(out)
+}
+
+// Dir replays the request dumps of dir against the server at target, in the
+// order of their file names, calling fn with the path and the response, or
+// the error, of each. The bodies of the responses are closed after fn.
+func Dir(ctx context.Context, client *http.Client, target, dir string, fn func(path string, resp *http.Response, err error)) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.http"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		resp, err := File(ctx, client, target, path)
+		fn(path, resp, err)
+		if resp != nil {
+			resp.Body.Close()
+		}
+	}
+	return nil
+}
+
+// readBody reads the body of req into memory.
+func readBody(req *http.Request) (io.ReadCloser, error) {
+	b, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(b)), nil
+}
@@ -0,0 +1,71 @@
+package lg
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RequestFileHook is a logrus hook for local debugging, appending the lines
+// of each request, those with a req_id field, to a file of its own named
+// <req_id>.log in Dir, so the lines of a failing request can be read apart
+// from the interleaved output of the other requests:
+//
+//	logger.Hooks.Add(&lg.RequestFileHook{Dir: "./logs"})
+//
+// The files are never removed, it's not meant for production.
+type RequestFileHook struct {
+	Dir       string           // directory of the files, created if missing
+	Formatter logrus.Formatter // formatter of the lines, the one of the logger when nil
+
+	mu sync.Mutex
+}
+
+func (h *RequestFileHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *RequestFileHook) Fire(entry *logrus.Entry) error {
+	reqID, _ := entry.Data["req_id"].(string)
+	name := requestFileName(reqID)
+	if name == "" {
+		return nil
+	}
+	formatter := h.Formatter
+	if formatter == nil {
+		formatter = entry.Logger.Formatter
+	}
+	b, err := formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := os.MkdirAll(h.Dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(h.Dir, name+".log"), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// requestFileName returns the name of the files of the request id, without
+// extension, with the characters which aren't safe in a file name replaced.
+func requestFileName(reqID string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, reqID)
+}
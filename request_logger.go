@@ -1,44 +1,137 @@
 package lg
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"os"
+	"runtime"
 	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/sirupsen/logrus"
 )
 
 // RequestLogger is a middleware for the github.com/sirupsen/logrus to log requests.
 // It is equipt to handle recovery in case of panics and record the stack trace
-// with a panic log-level.
-func RequestLogger(logger *logrus.Logger) func(next http.Handler) http.Handler {
-	httpLogger := &HTTPLogger{logger}
+// with a panic log-level. Its behaviour can be adjusted with options, such as:
+//
+//	lg.RequestLogger(logger, lg.WithSkipPaths("/ping"), lg.WithSlowThreshold(time.Second))
+func RequestLogger(logger *logrus.Logger, opts ...Option) func(next http.Handler) http.Handler {
+	var config RequestLoggerConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return RequestLoggerWithConfig(logger, config)
+}
+
+// RequestLoggerWithConfig is the same as RequestLogger, but accepts additional
+// settings for the middleware, see RequestLoggerConfig. The output of logger
+// is wrapped to serialize its writes with the loggers derived from it for the
+// requests, such as by SetRequestLevel. The derived loggers are kept for the
+// life of the process, with logger, which is meant to be created once.
+func RequestLoggerWithConfig(logger *logrus.Logger, config RequestLoggerConfig) func(next http.Handler) http.Handler {
+	lockOutput(logger)
+	return requestLogger(&configuredHTTPLogger{HTTPLogger{logger}, &config}, &config)
+}
 
+// logEntryMaker creates the log entry of a request, it's implemented by
+// HTTPLogger and SanitizingHTTPLogger.
+type logEntryMaker interface {
+	NewLogEntry(r *http.Request) *HTTPLoggerEntry
+}
+
+func requestLogger(httpLogger logEntryMaker, config *RequestLoggerConfig) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
 			entry := httpLogger.NewLogEntry(r)
 			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			entry.resp = ww
 
 			t1 := time.Now()
+			entry.start = t1
+			if config.TrackInFlight {
+				trackInFlight(entry, t1)
+				defer untrackInFlight(entry)
+			}
 			defer func() {
 				t2 := time.Now()
 
 				// Recover and record stack traces in case of a panic
-				if rec := recover(); rec != nil {
+				recent := 0
+				rec := recover()
+				if rec != nil && config.Repanic {
+					// Record the panic, and leave its recovery to a Recoverer.
+					entry.Panic(rec, debug.Stack())
+					status := ww.Status()
+					if status == 0 {
+						status = http.StatusInternalServerError
+					}
+					entry.Write(status, ww.BytesWritten(), t2.Sub(t1))
+					markPanicLogged(r)
+					panic(rec)
+				}
+				if rec != nil {
+					recent = countPanic(r, rec)
 					entry.Panic(rec, debug.Stack())
 					http.Error(ww, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 				}
 
 				// Log the entry, the request is complete.
 				entry.Write(ww.Status(), ww.BytesWritten(), t2.Sub(t1))
+
+				if config.MaxPanicsPerMinute > 0 && recent > config.MaxPanicsPerMinute {
+					entry.lineLogger().WithField("panics_per_minute", recent).Errorln("too many panics, exiting")
+					exit(2)
+				}
 			}()
 
+			if config.DumpDir != "" && r.Body != nil && r.Body != http.NoBody {
+				entry.dump = newDumpBody(r.Body, config.DumpBodyLimit)
+				r.Body = entry.dump
+			}
+			if config.MultipartParts && r.Body != nil {
+				if body := newMultipartBody(r); body != nil {
+					entry.multipart = body
+					r.Body = body
+				}
+			}
+			if config.BodyKeys {
+				if body := newKeysBody(r); body != nil {
+					entry.keysBody = body
+					r.Body = body
+				}
+			}
+			if (config.RequestBytes || config.UploadProgressInterval > 0) && r.Body != nil && r.Body != http.NoBody {
+				entry.body = newCountingBody(r.Body, entry, config.UploadProgressInterval)
+				r.Body = entry.body
+			}
+
 			r = r.WithContext(WithLogEntry(r.Context(), entry))
+			if config.InformationalResponses || config.ServerTiming || config.StatusAssertions || config.WriteErrors {
+				next.ServeHTTP(newInformationalWriter(ww, entry), r)
+				return
+			}
 			next.ServeHTTP(ww, r)
 		}
-		return http.HandlerFunc(fn)
+		if !config.RequestID && config.watcher == nil {
+			return http.HandlerFunc(fn)
+		}
+
+		// Inject a request id for requests which don't have one yet, so
+		// the req_id field is always present.
+		withReqID := middleware.RequestID(http.HandlerFunc(fn))
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if middleware.GetReqID(r.Context()) == "" && config.current().RequestID {
+				withReqID.ServeHTTP(w, r)
+				return
+			}
+			fn(w, r)
+		})
 	}
 }
 
@@ -47,43 +140,110 @@ type HTTPLogger struct {
 }
 
 func (l *HTTPLogger) NewLogEntry(r *http.Request) *HTTPLoggerEntry {
-	entry := &HTTPLoggerEntry{Logger: logrus.NewEntry(l.Logger)}
+	return l.newLogEntry(r, &emptyConfig)
+}
+
+// configuredHTTPLogger is the HTTPLogger of RequestLoggerWithConfig, creating
+// the log entries with its config.
+type configuredHTTPLogger struct {
+	HTTPLogger
+	config *RequestLoggerConfig
+}
+
+func (l *configuredHTTPLogger) NewLogEntry(r *http.Request) *HTTPLoggerEntry {
+	return l.newLogEntry(r, l.config)
+}
+
+func (l *HTTPLogger) newLogEntry(r *http.Request, config *RequestLoggerConfig) *HTTPLoggerEntry {
+	config = config.current()
+	logger := l.Logger
+	if config.InterceptFatal {
+		logger = interceptFatalLogger(logger)
+	}
+	entry := &HTTPLoggerEntry{Logger: logrus.NewEntry(entryLogger(logger)), config: config, req: r}
+	entry.quiet = config.quiet(r)
+	entry.demoted = config.demoted(r)
 	logFields := logrus.Fields{}
 
 	if reqID := middleware.GetReqID(r.Context()); reqID != "" {
-		logFields["req_id"] = reqID
+		logFields["req_id"] = cleanString(reqID)
 	}
 
 	scheme := "http"
 	if r.TLS != nil {
 		scheme = "https"
 	}
-	host := r.Host
+	host := cleanString(r.Host)
 
 	logFields["http_scheme"] = scheme
-	logFields["http_proto"] = r.Proto
+	logFields["http_proto"] = httpProto(r)
+	if id := streamID(r); id >= 0 {
+		logFields["http_stream_id"] = id
+	}
 	logFields["http_method"] = r.Method
 
 	logFields["remote_addr"] = r.RemoteAddr
-	logFields["user_agent"] = r.UserAgent()
+	logFields["user_agent"] = cleanString(r.UserAgent())
 
-	if val := r.Header.Get("X-Forwarded-For"); val != "" {
+	if val := cleanString(r.Header.Get("X-Forwarded-For")); val != "" {
 		logFields["X-Forwarded-For"] = val
 	}
-	if val := r.Header.Get("X-Forwarded-Host"); val != "" {
+	if val := cleanString(r.Header.Get("X-Forwarded-Host")); val != "" {
 		logFields["X-Forwarded-Host"] = val
 		host = val
 	}
-	if val := r.Header.Get("X-Forwarded-Scheme"); val != "" {
+	if val := cleanString(r.Header.Get("X-Forwarded-Scheme")); val != "" {
 		logFields["X-Forwarded-Scheme"] = val
 		scheme = val
 	}
 
-	logFields["uri"] = fmt.Sprintf("%s://%s%s", scheme, host, r.RequestURI)
+	if config.GoroutineDiagnostics {
+		logFields["goroutine_id"] = goroutineID()
+		logFields["num_goroutine"] = runtime.NumGoroutine()
+	}
+
+	if config.Bots != nil {
+		if isBot, verified := config.Bots.detect(r); isBot {
+			logFields["is_bot"] = true
+			if verified != nil {
+				logFields["bot_verified"] = *verified
+			}
+			switch config.Bots.Action {
+			case BotSkip:
+				entry.quiet = true
+			case BotSample:
+				if !entry.quiet && sampleValue(r, config.TrustRequestID) >= config.Bots.SampleRate {
+					atomic.AddUint64(&counters.SampledOut, 1)
+					entry.quiet = true
+				}
+			}
+		}
+	}
+
+	if depth := requestDepth(r); depth > 0 {
+		logFields["req_depth"] = depth
+	}
+	if val := cleanString(r.Header.Get(CallingServiceHeader)); val != "" {
+		logFields["calling_service"] = val
+	}
+
+	if len(config.SanitizeRules) == 0 {
+		logFields["uri"] = fmt.Sprintf("%s://%s%s", scheme, host, cleanString(r.RequestURI))
+	} else if uri, ok := sanitizeRequestURI(r.RequestURI, config.SanitizeRules); ok {
+		logFields["uri"] = fmt.Sprintf("%s://%s%s", scheme, host, cleanString(uri))
+	}
 
 	entry.Logger = entry.Logger.WithFields(logFields)
 
-	entry.Logger.Infoln("request started")
+	if config.StartedLineDelay > 0 {
+		entry.startedTimer = time.AfterFunc(config.StartedLineDelay, entry.writeStarted)
+	} else {
+		entry.writeStarted()
+	}
+
+	if config.Security != nil {
+		config.Security.checkRequest(WithLogEntry(r.Context(), entry), r)
+	}
 
 	return entry
 }
@@ -91,41 +251,556 @@ func (l *HTTPLogger) NewLogEntry(r *http.Request) *HTTPLoggerEntry {
 type HTTPLoggerEntry struct {
 	Logger logrus.FieldLogger // field logger interface, created by RequestLogger
 	Level  *logrus.Level      // intended log level to write when request finishes
+
+	// mu guards Logger, Level and quiet, and the state recorded during the
+	// request: loggedErr, writeErr, ctx, outCalls, outElapsed, budget,
+	// completion, provenance, spans, subtasks and informational, which may
+	// be changed by the goroutines of the handler. Logger is replaced, never
+	// modified, when fields are added, so a logger returned by Log(ctx) is
+	// not affected by the fields added after it.
+	mu sync.Mutex
+
+	config        *RequestLoggerConfig
+	req           *http.Request
+	resp          middleware.WrapResponseWriter
+	err           error         // recovered panic of the request
+	loggedErr     error         // last error logged with LogError
+	writeErr      error         // first error writing the response body
+	body          *countingBody // counts the bytes of the request body
+	multipart     *multipartBody
+	keysBody      *keysBody
+	dump          *dumpBody       // keeps the request body for DumpDir
+	ctx           context.Context // context recorded by CaptureContext
+	outCalls      int             // outbound requests made through Transport
+	outElapsed    time.Duration
+	budget        time.Duration      // latency budget set with SetBudget
+	completion    logrus.Fields      // fields of the completion line only, see SetCompletionField
+	provenance    map[string]string  // where the fields were set, see FieldProvenance
+	spans         []span             // spans ended with StartSpan
+	parent        *HTTPLoggerEntry   // request entry of a subtask entry, see Sub
+	base          logrus.Fields      // fields of the parent when the subtask started
+	subtasks      []*HTTPLoggerEntry // subtask entries, for SubtaskRollup
+	start         time.Time          // start of the request, with its monotonic clock reading
+	started       sync.Once          // writes the started line
+	startedTimer  *time.Timer        // delays the started line, see StartedLineDelay
+	informational []int              // statuses of the 1xx responses
+	quiet         bool               // skipped or sampled out, only warnings and errors are written
+	demoted       bool               // info lines are written at the debug level
+}
+
+// conf returns the config of the entry, which is nil for the entries created
+// without a request logger, such as &HTTPLoggerEntry{Logger: e}.
+func (l *HTTPLoggerEntry) conf() *RequestLoggerConfig {
+	if l.config == nil {
+		return &emptyConfig
+	}
+	return l.config
 }
 
 func (l *HTTPLoggerEntry) Write(status, bytes int, elapsed time.Duration) {
-	l.Logger = l.Logger.WithFields(logrus.Fields{
+	// The started line of a delayed request which completes in time is
+	// never written.
+	if l.startedTimer != nil {
+		l.startedTimer.Stop()
+		l.started.Do(func() {})
+	}
+
+	if l.conf().StatusAssertions && status == 0 && l.err == nil {
+		l.assertStatus("no response written by the handler")
+	}
+
+	if l.conf().FieldProvenance {
+		if fields := l.provenanceFields(); fields != nil {
+			l.AddFields(fields)
+		}
+	}
+
+	l.AddFields(logrus.Fields{
 		"resp_status": status, "resp_bytes_length": bytes,
 		"resp_elapsed_ms": float64(elapsed.Nanoseconds()) / 1000000.0,
 	})
 
-	if l.Level == nil {
-		l.Logger.Infoln("request complete")
+	l.mu.Lock()
+	completion := l.completion
+	l.mu.Unlock()
+	if len(completion) > 0 {
+		// Their provenance is recorded by addCompletionFields
+		l.withFields(completion)
+	}
+
+	if fields := l.spanFields(); len(fields) > 0 {
+		l.AddFields(fields)
+	}
+
+	if l.conf().SubtaskRollup {
+		if subtasks := l.subtaskFields(); len(subtasks) > 0 {
+			l.AddFields(logrus.Fields{"subtasks": subtasks})
+		}
+	}
+
+	if l.conf().StartEndTimestamps && !l.start.IsZero() {
+		// The end is derived from the monotonic elapsed time, so that
+		// ts_end - ts_start is resp_elapsed_ms even if the wall clock
+		// jumps during the request.
+		l.AddFields(logrus.Fields{
+			"ts_start": l.start.Format(time.RFC3339Nano),
+			"ts_end":   l.start.Add(elapsed).Format(time.RFC3339Nano),
+		})
+	}
+
+	if l.multipart != nil {
+		if parts := l.multipart.finish(); len(parts) > 0 {
+			l.AddFields(logrus.Fields{"req_multipart_parts": parts})
+		}
+	}
+
+	if l.keysBody != nil {
+		if keys := l.keysBody.keys(); keys != nil {
+			l.AddFields(logrus.Fields{"req_body_keys": keys})
+		}
+	}
+
+	if l.conf().RequestBytes || l.conf().UploadProgressInterval > 0 {
+		var n int64
+		if l.body != nil {
+			n = l.body.bytesRead()
+		}
+		l.AddFields(logrus.Fields{"req_bytes": n})
+	}
+
+	if len(l.conf().DurationBuckets) > 0 {
+		l.AddFields(logrus.Fields{"resp_elapsed_bucket": durationBucket(elapsed, l.conf().DurationBuckets)})
+	}
+
+	if l.conf().GoroutineDiagnostics {
+		l.AddFields(logrus.Fields{"num_goroutine": runtime.NumGoroutine()})
+	}
+
+	if len(l.conf().ContextFields) > 0 {
+		l.AddFields(l.contextFields())
+	}
+
+	if l.conf().OperationID != nil {
+		if op := l.conf().OperationID(l.req); op != "" {
+			l.AddFields(logrus.Fields{"operation_id": op})
+		}
+	}
+
+	l.mu.Lock()
+	err := l.loggedErr
+	l.mu.Unlock()
+	if l.err != nil {
+		err = l.err
+	}
+	if fields := errorFields(err); fields != nil {
+		l.AddFields(fields)
+	}
+
+	if l.conf().IsError != nil {
+		l.AddFields(logrus.Fields{"slo_error": l.conf().IsError(status, l.req, l.err)})
+	}
+
+	if len(l.conf().TrailerFields) > 0 {
+		l.AddFields(l.trailerFields(l.conf().TrailerFields))
+	}
+	l.mu.Lock()
+	informational := l.informational
+	outCalls, outElapsed := l.outCalls, l.outElapsed
+	budget := l.budget
+	l.mu.Unlock()
+	if budget > 0 {
+		l.AddFields(logrus.Fields{
+			"budget_ms":   float64(budget.Nanoseconds()) / 1000000.0,
+			"over_budget": elapsed > budget,
+		})
+	}
+	if outCalls > 0 {
+		l.AddFields(logrus.Fields{
+			"outbound_calls": outCalls,
+			"outbound_ms":    float64(outElapsed.Nanoseconds()) / 1000000.0,
+		})
+	}
+	if len(informational) > 0 {
+		l.AddFields(logrus.Fields{"informational_responses": informational})
+	}
+
+	if l.conf().RangeFields {
+		if fields := rangeFields(l.req, status); fields != nil {
+			l.AddFields(fields)
+		}
+	}
+
+	if l.conf().ContentHeaders {
+		l.AddFields(l.responseHeaderFields(contentHeaders))
+	}
+
+	// Audit the throttling of the clients.
+	if status == http.StatusTooManyRequests {
+		l.AddFields(l.responseHeaderFields(rateLimitHeaders))
+		l.AddFields(logrus.Fields{"rate_limited": true})
+	}
+
+	if len(l.conf().ResponseHeaders) > 0 {
+		l.AddFields(l.responseHeaderFields(l.conf().ResponseHeaders))
+	}
+
+	if l.conf().CacheHeaders {
+		l.AddFields(l.responseHeaderFields(cacheHeaders))
+		if status == http.StatusNotModified {
+			l.AddFields(logrus.Fields{"not_modified": true})
+		}
+	}
+
+	// Record the time left before the deadline of the request, if it has one,
+	// and flag the requests which completed after it. The deadline is usually
+	// set by a timeout middleware after the request logger, so it's read from
+	// the context recorded by CaptureContext.
+	if deadline, ok := l.context().Deadline(); ok {
+		remaining := time.Until(deadline)
+		l.AddFields(logrus.Fields{"deadline_remaining_ms": float64(remaining.Nanoseconds()) / 1000000.0})
+		if remaining < 0 {
+			l.AddFields(logrus.Fields{"deadline_exceeded": true})
+		}
+	}
+
+	l.mu.Lock()
+	override := l.Level
+	l.mu.Unlock()
+
+	policy := l.conf().StatusPolicies[status]
+	level := logrus.InfoLevel
+	if override != nil {
+		level = *override
+	} else if policy.Level != nil {
+		level = *policy.Level
+	} else if l.conf().LevelForStatus != nil {
+		level = l.conf().LevelForStatus(status)
+	}
+	if policy.Counts != nil {
+		policy.Counts.add(status)
+	}
+	l.mu.Lock()
+	writeErr := l.writeErr
+	l.mu.Unlock()
+	if writeErr != nil {
+		clientAbort := isClientAbort(writeErr)
+		l.AddFields(logrus.Fields{"write_err": writeErr.Error(), "write_err_client": clientAbort})
+		if !clientAbort && level > logrus.ErrorLevel {
+			level = logrus.ErrorLevel
+		}
+	}
+	if l.conf().SlowThreshold > 0 && elapsed >= l.conf().SlowThreshold {
+		l.AddFields(logrus.Fields{"slow": true})
+		if level > logrus.WarnLevel {
+			level = logrus.WarnLevel
+		}
+	}
+	if l.conf().LatencyBaseline != nil {
+		route := l.req.Method + " " + routePattern(l.req)
+		if anomaly, baseline := l.conf().LatencyBaseline.observe(route, elapsed); anomaly {
+			l.AddFields(logrus.Fields{"latency_anomaly": true, "latency_baseline_ms": baseline})
+			if level > logrus.WarnLevel {
+				level = logrus.WarnLevel
+			}
+		}
+	}
+	if status >= 500 || (status >= 400 && l.conf().SkipPreflight && isPreflight(l.req)) {
+		l.mu.Lock()
+		l.quiet = false
+		l.mu.Unlock()
+	}
+	if policy.Skip && l.err == nil {
+		atomic.AddUint64(&counters.EntriesDropped, 1)
 	} else {
-		switch *l.Level {
-		case logrus.DebugLevel:
-			l.Logger.Debugln("request complete")
-		case logrus.InfoLevel:
-			l.Logger.Infoln("request complete")
-		case logrus.WarnLevel:
-			l.Logger.Warnln("request complete")
-		case logrus.ErrorLevel:
-			l.Logger.Errorln("request complete")
-		case logrus.FatalLevel:
-			l.Logger.Fatalln("request complete")
-		case logrus.PanicLevel:
-			l.Logger.Errorln("request complete")
+		l.log(level, "request complete")
+	}
+
+	if l.conf().Security != nil {
+		l.conf().Security.checkResponse(WithLogEntry(l.req.Context(), l), l.req, status)
+	}
+
+	if l.conf().DumpDir != "" && (status >= 500 || l.err != nil) {
+		l.writeDump()
+	}
+
+	if l.conf().OnServerError != nil && (status >= 500 || l.err != nil) {
+		l.conf().OnServerError(l, status)
+	}
+
+	if l.conf().OnComplete != nil {
+		fields := copyFields(l.fields())
+		if l.conf().rewritesFields() {
+			fields = l.rewriteFields(fields)
+		}
+		l.conf().OnComplete(l.req, status, bytes, elapsed, fields)
+	}
+}
+
+// log writes msg with the fields of the entry at the given level, after
+// running the fields through the BeforeWrite hooks, field policy, secrets
+// redaction and size limits of the config, unless the Filter of the config
+// drops the line. A panic level is written as an error, as the panic has
+// already been recovered.
+func (l *HTTPLoggerEntry) log(level logrus.Level, msg string) {
+	l.logWith(nil, level, msg)
+}
+
+// logWith is the same as log, with additional fields for this line only.
+func (l *HTTPLoggerEntry) logWith(fields logrus.Fields, level logrus.Level, msg string) {
+	l.mu.Lock()
+	var logger logrus.FieldLogger = l.Logger
+	quiet := l.quiet
+	l.mu.Unlock()
+	if len(fields) > 0 {
+		logger = logger.WithFields(fields)
+	}
+
+	if quiet && level > logrus.WarnLevel {
+		atomic.AddUint64(&counters.EntriesDropped, 1)
+		return
+	}
+	if l.demoted && level == logrus.InfoLevel {
+		level = logrus.DebugLevel
+	}
+
+	// A panicking BeforeWrite hook, Filter, logrus hook, formatter or output
+	// must not take down the request: the line is written as plain text to
+	// stderr instead. The panics aborting the request on an intercepted
+	// fatal line go through.
+	defer func() {
+		if rec := recover(); rec != nil {
+			if _, ok := rec.(*fatalError); ok {
+				panic(rec)
+			}
+			atomic.AddUint64(&counters.PipelinePanics, 1)
+			fmt.Fprintf(os.Stderr, "lg: logging panicked: %v: level=%s msg=%q\n", rec, level, msg)
+		}
+	}()
+
+	if e, ok := logger.(*logrus.Entry); ok && l.conf().rewritesFields() {
+		logger = logrus.NewEntry(e.Logger).WithFields(l.rewriteFields(copyFields(e.Data)))
+	}
+	if l.conf().Filter != nil {
+		var fields logrus.Fields
+		if e, ok := logger.(*logrus.Entry); ok {
+			fields = e.Data
+		}
+		if !l.conf().Filter(level, msg, fields) {
+			atomic.AddUint64(&counters.EntriesDropped, 1)
+			return
+		}
+	}
+
+	atomic.AddUint64(&counters.EntriesWritten, 1)
+	switch level {
+	case logrus.DebugLevel:
+		logger.Debugln(msg)
+	case logrus.InfoLevel:
+		logger.Infoln(msg)
+	case logrus.WarnLevel:
+		logger.Warnln(msg)
+	case logrus.ErrorLevel:
+		logger.Errorln(msg)
+	case logrus.FatalLevel:
+		logger.Fatalln(msg)
+	case logrus.PanicLevel:
+		logger.Errorln(msg)
+	}
+}
+
+// rewriteFields runs the fields of a line through the BeforeWrite hooks, field
+// policy, secrets redaction and size limits of the config. fields is modified.
+func (l *HTTPLoggerEntry) rewriteFields(fields logrus.Fields) logrus.Fields {
+	for _, fn := range l.conf().BeforeWrite {
+		fields = fn(l, fields)
+	}
+	if l.conf().FieldPolicy != nil {
+		fields = l.conf().FieldPolicy.apply(fields, l.conf().FieldTags)
+	}
+	if l.conf().RedactSecrets {
+		fields = redactSecrets(fields)
+	}
+	return truncateFields(fields, l.conf().MaxFieldLength, l.conf().MaxEntrySize)
+}
+
+// AddFields adds fields to the entry, they're included in the lines logged
+// with the entry from then on, and in the completion line. It's safe to call
+// from multiple goroutines, the last value set for a key wins.
+func (l *HTTPLoggerEntry) AddFields(fields logrus.Fields) {
+	if l.conf().FieldProvenance {
+		l.recordProvenance(fields)
+	}
+	l.withFields(fields)
+}
+
+// withFields adds fields to the entry, without recording their provenance.
+func (l *HTTPLoggerEntry) withFields(fields logrus.Fields) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.Logger = l.Logger.WithFields(fields)
+}
+
+// SetLevel sets the level of the completion line of the request.
+func (l *HTTPLoggerEntry) SetLevel(level logrus.Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.Level = &level
+}
+
+// setLevelIfUnset sets the level of the completion line of the request, unless
+// it's already set.
+func (l *HTTPLoggerEntry) setLevelIfUnset(level logrus.Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.Level == nil {
+		l.Level = &level
+	}
+}
+
+// writeStarted writes the started line of the request, once.
+func (l *HTTPLoggerEntry) writeStarted() {
+	l.started.Do(func() {
+		l.log(logrus.InfoLevel, "request started")
+	})
+}
+
+// addOutbound records an outbound request made through Transport.
+func (l *HTTPLoggerEntry) addOutbound(elapsed time.Duration) {
+	if l.parent != nil {
+		l.parent.addOutbound(elapsed)
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.outCalls++
+	l.outElapsed += elapsed
+}
+
+// addInformational records the status of a 1xx response.
+func (l *HTTPLoggerEntry) addInformational(status int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.informational = append(l.informational, status)
+}
+
+// logger returns the field logger of the entry.
+func (l *HTTPLoggerEntry) logger() logrus.FieldLogger {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.Logger
+}
+
+// lineLogger returns the field logger of the entry for the lines logged
+// outside of the request logger, such as through Log(ctx), which are marked
+// with entryKey to be run through rewriteFields as well.
+func (l *HTTPLoggerEntry) lineLogger() logrus.FieldLogger {
+	logger := l.logger()
+	if !l.conf().rewritesFields() {
+		return logger
+	}
+	return logger.WithField(entryKey, l)
+}
+
+// addCompletionFields adds fields to the completion line only.
+func (l *HTTPLoggerEntry) addCompletionFields(fields logrus.Fields) {
+	if l.parent != nil {
+		l.parent.addCompletionFields(fields)
+		return
+	}
+	if l.conf().FieldProvenance {
+		l.recordProvenance(fields)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	completion := make(logrus.Fields, len(l.completion)+len(fields))
+	for k, v := range l.completion {
+		completion[k] = v
+	}
+	for k, v := range fields {
+		completion[k] = v
+	}
+	l.completion = completion
+}
+
+// Suppress drops the info and debug lines of the request logger for the rest
+// of the request, the same as for skipped paths. Warnings and errors are
+// still written.
+func (l *HTTPLoggerEntry) Suppress() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.quiet = true
+}
+
+// setLoggerLevel switches the entry to a logger with the given level, which
+// shares the output, formatter and hooks of the logger of the entry.
+func (l *HTTPLoggerEntry) setLoggerLevel(level logrus.Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.Logger.(*logrus.Entry)
+	if !ok {
+		return
+	}
+	l.Logger = logrus.NewEntry(levelLogger(e.Logger, level)).WithFields(e.Data)
+	if level >= logrus.InfoLevel {
+		l.quiet = false
+	}
+}
+
+// responseHeaderFields returns the fields of the given response headers which
+// are set, named after the header, such as resp_cache_control. A name ending
+// with a "*" matches the headers starting with it, such as X-RateLimit-*.
+func (l *HTTPLoggerEntry) responseHeaderFields(names []string) logrus.Fields {
+	fields := logrus.Fields{}
+	if l.resp == nil {
+		return fields
+	}
+	header := l.resp.Header()
+	for _, name := range names {
+		if prefix := strings.TrimSuffix(name, "*"); prefix != name {
+			for key, vals := range header {
+				if len(vals) > 0 && vals[0] != "" && hasPrefixFold(key, prefix) {
+					fields[headerFieldKey("resp_", key)] = vals[0]
+				}
+			}
+			continue
 		}
+		if val := header.Get(name); val != "" {
+			fields[headerFieldKey("resp_", name)] = val
+		}
+	}
+	return fields
+}
+
+// fields returns the fields accumulated on the entry so far.
+func (l *HTTPLoggerEntry) fields() logrus.Fields {
+	if e, ok := l.logger().(*logrus.Entry); ok {
+		return e.Data
+	}
+	return logrus.Fields{}
+}
+
+// copyFields returns a copy of fields, for the rewrites not to change the
+// fields of the entry.
+func copyFields(fields logrus.Fields) logrus.Fields {
+	c := make(logrus.Fields, len(fields))
+	for k, v := range fields {
+		c[k] = v
 	}
+	return c
 }
 
 func (l *HTTPLoggerEntry) Panic(rec interface{}, stack []byte) {
-	l.Logger = l.Logger.WithFields(logrus.Fields{
-		"stack": string(stack),
-		"panic": fmt.Sprintf("%+v", rec),
+	l.AddFields(logrus.Fields{
+		"stack":       string(stack),
+		"panic":       cleanString(fmtPanic(rec)),
+		"panic_group": panicGroup(stack),
 	})
-	panicLevel := logrus.PanicLevel
-	l.Level = &panicLevel
+	if err, ok := rec.(error); ok {
+		l.err = err
+	} else {
+		l.err = fmt.Errorf("%s", fmtPanic(rec))
+	}
+	l.SetLevel(logrus.PanicLevel)
 }
 
 // PrintPanics is a development middleware that preempts the request logger
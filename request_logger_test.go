@@ -0,0 +1,131 @@
+package lg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TestEntryWithoutConfig uses an entry built directly, as before the request
+// logger had settings, which has no config.
+func TestEntryWithoutConfig(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &buf
+
+	entry := &HTTPLoggerEntry{Logger: logrus.NewEntry(logger)}
+	ctx := WithLogEntry(context.Background(), entry)
+	entry.AddFields(logrus.Fields{"user": "ann"})
+	SetEntryField(ctx, "tenant", "acme")
+	Log(ctx).Infoln("working")
+	entry.Panic("boom", []byte("stack"))
+	entry.Write(500, 0, 0)
+
+	out := buf.String()
+	for _, s := range []string{"working", "boom", "resp_status=500", "tenant=acme", "user=ann"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("%q missing from %s", s, out)
+		}
+	}
+}
+
+// hijackRecorder is a response writer which can be hijacked but not flushed.
+type hijackRecorder struct {
+	http.ResponseWriter
+}
+
+func (w hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, http.ErrHijacked
+}
+
+// TestInformationalWriterInterfaces checks that the writer of the handler only
+// has the optional interfaces of the writer it wraps.
+func TestInformationalWriterInterfaces(t *testing.T) {
+	tests := []struct {
+		name   string
+		w      http.ResponseWriter
+		fl, hj bool
+	}{
+		{"flusher", httptest.NewRecorder(), true, false},
+		{"hijacker", hijackRecorder{httptest.NewRecorder()}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := logrus.New()
+			logger.Out = ioutil.Discard
+			h := RequestLogger(logger, WithWriteErrors())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if _, ok := w.(http.Flusher); ok != tt.fl {
+					t.Errorf("http.Flusher = %v, want %v", ok, tt.fl)
+				}
+				if _, ok := w.(http.Hijacker); ok != tt.hj {
+					t.Errorf("http.Hijacker = %v, want %v", ok, tt.hj)
+				}
+				if _, ok := w.(io.ReaderFrom); ok {
+					t.Error("io.ReaderFrom implemented")
+				}
+				if f, ok := w.(http.Flusher); ok {
+					f.Flush()
+				}
+			}))
+			h.ServeHTTP(tt.w, httptest.NewRequest("GET", "/", nil))
+		})
+	}
+}
+
+// TestRecovererRepanic checks that a panic is logged once, by the request
+// logger, with a Recoverer before it.
+func TestRecovererRepanic(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &buf
+
+	var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	h = RequestLogger(logger, WithRepanic())(h)
+	h = Recoverer()(h)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	h.ServeHTTP(rec, req.WithContext(WithLoggerContext(req.Context(), logger)))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status %d, want 500", rec.Code)
+	}
+	if n := strings.Count(buf.String(), "panic=boom"); n != 1 {
+		t.Errorf("panic logged %d times, want once: %s", n, buf.String())
+	}
+}
+
+// TestInterceptFatalNotCounted checks that the requests aborted on a fatal
+// line don't count as panics.
+func TestInterceptFatalNotCounted(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &buf
+
+	before := Stats().PanicsRecovered
+	h := RequestLogger(logger, WithInterceptFatal())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Log(r.Context()).Fatalln("no database")
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status %d, want 500", rec.Code)
+	}
+	if n := Stats().PanicsRecovered - before; n != 0 {
+		t.Errorf("%d panics counted, want 0", n)
+	}
+	if !strings.Contains(buf.String(), "fatal_intercepted=true") {
+		t.Errorf("fatal line missing from %s", buf.String())
+	}
+}
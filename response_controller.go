@@ -0,0 +1,33 @@
+package lg
+
+import (
+	"net/http"
+	"time"
+)
+
+// The response writer given to the handlers by the request logger forwards
+// Unwrap, so http.ResponseController reaches the deadlines, flushing and full
+// duplex support of the underlying writer. The helpers below also record the
+// deadline overrides on the request entry.
+
+// SetReadDeadline sets the read deadline of the request with an
+// http.ResponseController, and logs it as read_deadline_ms, the time left
+// from now, or 0 when the deadline is removed.
+func SetReadDeadline(w http.ResponseWriter, r *http.Request, deadline time.Time) error {
+	SetEntryField(r.Context(), "read_deadline_ms", deadlineMillis(deadline))
+	return http.NewResponseController(w).SetReadDeadline(deadline)
+}
+
+// SetWriteDeadline is the same as SetReadDeadline, for the write deadline of
+// the response, logged as write_deadline_ms.
+func SetWriteDeadline(w http.ResponseWriter, r *http.Request, deadline time.Time) error {
+	SetEntryField(r.Context(), "write_deadline_ms", deadlineMillis(deadline))
+	return http.NewResponseController(w).SetWriteDeadline(deadline)
+}
+
+func deadlineMillis(deadline time.Time) float64 {
+	if deadline.IsZero() {
+		return 0
+	}
+	return float64(time.Until(deadline).Nanoseconds()) / 1000000.0
+}
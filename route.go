@@ -0,0 +1,94 @@
+package lg
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// routePattern returns the chi route pattern matched by r, such as
+// "/articles/{id}", or an empty string if r wasn't routed by chi.
+func routePattern(r *http.Request) string {
+	// chi.RouteContext panics outside of a chi router.
+	if rctx, ok := r.Context().Value(chi.RouteCtxKey).(*chi.Context); ok && rctx != nil {
+		return rctx.RoutePattern()
+	}
+	return ""
+}
+
+// OperationIDs returns an OperationID resolver for the request logger, from a
+// map of the method and chi route pattern of the operations to their
+// operationId, such as:
+//
+//	lg.OperationIDs(map[string]string{
+//		"GET /articles/{id}": "getArticle",
+//		"POST /articles":     "createArticle",
+//	})
+func OperationIDs(ops map[string]string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		return ops[r.Method+" "+routePattern(r)]
+	}
+}
+
+// NotFound returns a handler for the NotFound of a chi router, which flags
+// the request with router_miss=true before calling next, or http.NotFound
+// when nil. The 404 of the requests which matched no route can then be told
+// apart from the 404 of the handlers for a missing resource:
+//
+//	r.NotFound(lg.NotFound(nil))
+func NotFound(next http.Handler) http.HandlerFunc {
+	if next == nil {
+		next = http.HandlerFunc(http.NotFound)
+	}
+	return routerMiss(next)
+}
+
+// MethodNotAllowed is the same as NotFound, for the MethodNotAllowed of a
+// chi router. It responds with a 405 and the Allow header of chi when next is
+// nil.
+func MethodNotAllowed(next http.Handler) http.HandlerFunc {
+	if next == nil {
+		next = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, method := range allowedMethods(r) {
+				w.Header().Add("Allow", method)
+			}
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		})
+	}
+	return routerMiss(next)
+}
+
+// routeMethods are the methods routed by chi, in the order of its Allow
+// header.
+var routeMethods = []string{
+	http.MethodConnect, http.MethodDelete, http.MethodGet, http.MethodHead,
+	http.MethodOptions, http.MethodPatch, http.MethodPost, http.MethodPut,
+	http.MethodTrace,
+}
+
+// allowedMethods returns the methods with a route for the path of r, which
+// chi doesn't expose to a custom MethodNotAllowed handler.
+func allowedMethods(r *http.Request) []string {
+	rctx, ok := r.Context().Value(chi.RouteCtxKey).(*chi.Context)
+	if !ok || rctx == nil || rctx.Routes == nil {
+		return nil
+	}
+	path := r.URL.RawPath
+	if path == "" {
+		path = r.URL.Path
+	}
+	var methods []string
+	for _, method := range routeMethods {
+		if rctx.Routes.Match(chi.NewRouteContext(), method, path) {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+func routerMiss(next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		SetEntryField(r.Context(), "router_miss", true)
+		next.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,77 @@
+package lg
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// AdaptiveSampler lowers the sampling rate of the request logger as the
+// request rate goes over TargetQPS, so that about TargetQPS requests per
+// second are logged at the info level under load. Warnings, errors and 5xx
+// responses are always logged. The effective rate is reported to Logger
+// (DefaultLogger when nil) every ReportInterval (a minute when zero), while
+// sampling is active.
+type AdaptiveSampler struct {
+	TargetQPS      float64
+	ReportInterval time.Duration
+	Logger         *logrus.Logger
+
+	mu         sync.Mutex
+	window     time.Time
+	count      int
+	rate       float64
+	qps        float64
+	lastReport time.Time
+}
+
+// keep counts a request and reports whether its info lines are kept, for the
+// sampling value u of the request, see sampleValue.
+func (s *AdaptiveSampler) keep(u float64) bool {
+	now := time.Now()
+
+	s.mu.Lock()
+	if s.window.IsZero() {
+		s.window, s.rate = now, 1
+	}
+	if elapsed := now.Sub(s.window); elapsed >= time.Second {
+		s.qps = float64(s.count) / elapsed.Seconds()
+		s.rate = 1
+		if s.qps > s.TargetQPS && s.TargetQPS > 0 {
+			s.rate = s.TargetQPS / s.qps
+		}
+		s.window, s.count = now, 0
+	}
+	s.count++
+	rate, qps := s.rate, s.qps
+
+	interval := s.ReportInterval
+	if interval == 0 {
+		interval = time.Minute
+	}
+	report := rate < 1 && now.Sub(s.lastReport) >= interval
+	if report {
+		s.lastReport = now
+	}
+	s.mu.Unlock()
+
+	if report {
+		logger := s.Logger
+		if logger == nil {
+			logger = DefaultLogger
+		}
+		logger.WithFields(logrus.Fields{"sample_rate": rate, "qps": qps}).Infoln("lg: adaptive sampling active")
+	}
+	return rate >= 1 || u < rate
+}
+
+// Rate returns the current effective sampling rate.
+func (s *AdaptiveSampler) Rate() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.window.IsZero() {
+		return 1
+	}
+	return s.rate
+}
@@ -4,10 +4,8 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
-	"runtime/debug"
-	"time"
 
-	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/sirupsen/logrus"
 )
 
@@ -22,32 +20,8 @@ import (
 //		"session": "removed-sesion-id",
 //	}
 func SanitizingRequestLogger(logger *logrus.Logger, rules map[string]string) func(next http.Handler) http.Handler {
-	httpLogger := &SanitizingHTTPLogger{logger, rules}
-
-	return func(next http.Handler) http.Handler {
-		fn := func(w http.ResponseWriter, r *http.Request) {
-			entry := httpLogger.NewLogEntry(r)
-			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
-
-			t1 := time.Now()
-			defer func() {
-				t2 := time.Now()
-
-				// Recover and record stack traces in case of a panic
-				if rec := recover(); rec != nil {
-					entry.Panic(rec, debug.Stack())
-					http.Error(ww, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-				}
-
-				// Log the entry, the request is complete.
-				entry.Write(ww.Status(), ww.BytesWritten(), t2.Sub(t1))
-			}()
-
-			r = r.WithContext(WithLogEntry(r.Context(), entry))
-			next.ServeHTTP(ww, r)
-		}
-		return http.HandlerFunc(fn)
-	}
+	lockOutput(logger)
+	return requestLogger(&SanitizingHTTPLogger{logger, rules}, &emptyConfig)
 }
 
 type SanitizingHTTPLogger struct {
@@ -56,58 +30,72 @@ type SanitizingHTTPLogger struct {
 }
 
 func (l *SanitizingHTTPLogger) NewLogEntry(r *http.Request) *HTTPLoggerEntry {
-	entry := &HTTPLoggerEntry{Logger: logrus.NewEntry(l.Logger)}
+	entry := &HTTPLoggerEntry{Logger: logrus.NewEntry(entryLogger(l.Logger)), config: &emptyConfig, req: r}
 	logFields := logrus.Fields{}
 
 	if reqID := middleware.GetReqID(r.Context()); reqID != "" {
-		logFields["req_id"] = reqID
+		logFields["req_id"] = cleanString(reqID)
 	}
 
 	scheme := "http"
 	if r.TLS != nil {
 		scheme = "https"
 	}
-	host := r.Host
+	host := cleanString(r.Host)
 
 	logFields["http_scheme"] = scheme
-	logFields["http_proto"] = r.Proto
+	logFields["http_proto"] = httpProto(r)
+	if id := streamID(r); id >= 0 {
+		logFields["http_stream_id"] = id
+	}
 	logFields["http_method"] = r.Method
 
 	logFields["remote_addr"] = r.RemoteAddr
-	logFields["user_agent"] = r.UserAgent()
+	logFields["user_agent"] = cleanString(r.UserAgent())
 
-	if val := r.Header.Get("X-Forwarded-For"); val != "" {
+	if val := cleanString(r.Header.Get("X-Forwarded-For")); val != "" {
 		logFields["X-Forwarded-For"] = val
 	}
-	if val := r.Header.Get("X-Forwarded-Host"); val != "" {
+	if val := cleanString(r.Header.Get("X-Forwarded-Host")); val != "" {
 		logFields["X-Forwarded-Host"] = val
 		host = val
 	}
-	if val := r.Header.Get("X-Forwarded-Scheme"); val != "" {
+	if val := cleanString(r.Header.Get("X-Forwarded-Scheme")); val != "" {
 		logFields["X-Forwarded-Scheme"] = val
 		scheme = val
 	}
 
-	if u, err := url.ParseRequestURI(r.RequestURI); err == nil {
-		q := u.Query()
-
-		// sanitize
-		for key, val := range q {
-			if rep, ok := l.Rules[key]; ok {
-				for i := 0; i < len(val); i++ {
-					val[i] = rep
-				}
-				q[key] = val
-			}
-		}
-		u.RawQuery = q.Encode()
-
-		logFields["uri"] = fmt.Sprintf("%s://%s%s", scheme, host, u.RequestURI())
+	if uri, ok := sanitizeRequestURI(r.RequestURI, l.Rules); ok {
+		logFields["uri"] = fmt.Sprintf("%s://%s%s", scheme, host, cleanString(uri))
 	}
 
 	entry.Logger = entry.Logger.WithFields(logFields)
 
-	entry.Logger.Infoln("request started")
+	entry.writeStarted()
 
 	return entry
 }
+
+// sanitizeRequestURI replaces the values of the query parameters of uri which
+// have a rule with the replacement of the rule. It returns false when the uri
+// can't be parsed.
+func sanitizeRequestURI(uri string, rules map[string]string) (string, bool) {
+	u, err := url.ParseRequestURI(uri)
+	if err != nil {
+		return "", false
+	}
+	q := u.Query()
+
+	// sanitize
+	for key, val := range q {
+		if rep, ok := rules[key]; ok {
+			for i := 0; i < len(val); i++ {
+				val[i] = rep
+			}
+			q[key] = val
+		}
+	}
+	u.RawQuery = q.Encode()
+
+	return u.RequestURI(), true
+}
@@ -0,0 +1,101 @@
+package lg
+
+import (
+	"regexp"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RedactedKey is the field listing the keys of the fields in which secrets
+// have been masked.
+var RedactedKey = "redacted_fields"
+
+// RedactedValue replaces the secrets found in field values.
+var RedactedValue = "[REDACTED]"
+
+// SecretPatterns are the patterns of values masked when RedactSecrets is set
+// on the request logger config. The credit card numbers are masked apart,
+// when they pass the Luhn checksum: within strings when their digits are
+// grouped, such as 4111 1111 1111 1111, as the long runs of digits are mostly
+// ids, or as the whole value of a field named after a card, such as
+// card_number.
+var SecretPatterns = []*regexp.Regexp{
+	// JSON Web Tokens
+	regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`),
+	// AWS access key ids
+	regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+	// Bearer and basic authorization credentials
+	regexp.MustCompile(`(?i)\b(?:bearer|basic)\s+[A-Za-z0-9._~+/=-]{8,}`),
+	// Private keys
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`),
+}
+
+// creditCardPattern matches the card numbers grouped by 4 digits, or 4, 6 and
+// 5 for American Express.
+var creditCardPattern = regexp.MustCompile(`\b\d{4}(?:[ -]\d{4}){3}(?:[ -]\d{3})?\b|\b\d{4}[ -]\d{6}[ -]\d{5}\b`)
+
+// cardNumberPattern matches the values of the fields named after a card.
+var cardNumberPattern = regexp.MustCompile(`^\d{13,19}$`)
+
+// cardKeyPattern matches the keys of the fields named after a card.
+var cardKeyPattern = regexp.MustCompile(`(?i)card|^pan$|^cc_?num`)
+
+// redactSecrets masks the secrets found in the string values of fields, and
+// lists the affected keys in RedactedKey.
+func redactSecrets(fields logrus.Fields) logrus.Fields {
+	var redacted []string
+	for k, v := range fields {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		masked := redactString(s)
+		if cardKeyPattern.MatchString(k) && cardNumberPattern.MatchString(masked) && luhnValid(masked) {
+			masked = RedactedValue
+		}
+		if masked != s {
+			fields[k] = masked
+			redacted = append(redacted, k)
+		}
+	}
+	if len(redacted) > 0 {
+		sort.Strings(redacted)
+		fields[RedactedKey] = redacted
+	}
+	return fields
+}
+
+// redactString masks the secrets found in s.
+func redactString(s string) string {
+	for _, re := range SecretPatterns {
+		s = re.ReplaceAllString(s, RedactedValue)
+	}
+	return creditCardPattern.ReplaceAllStringFunc(s, func(m string) string {
+		if luhnValid(m) {
+			return RedactedValue
+		}
+		return m
+	})
+}
+
+// luhnValid reports whether the digits of s pass the Luhn checksum.
+func luhnValid(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n > 0 && sum%10 == 0
+}
@@ -0,0 +1,35 @@
+package lg
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestRedactSecrets(t *testing.T) {
+	tests := []struct {
+		key, value, want string
+	}{
+		{"msg", "paid with 4111 1111 1111 1111", "paid with " + RedactedValue},
+		{"msg", "paid with 4111-1111-1111-1111", "paid with " + RedactedValue},
+		{"msg", "amex 3782 822463 10005", "amex " + RedactedValue},
+		// A Luhn-valid id within a string, or in a field not named after a
+		// card, is kept.
+		{"msg", "order 4111111111111111 shipped", "order 4111111111111111 shipped"},
+		{"order_id", "4111111111111111", "4111111111111111"},
+		{"card_number", "4111111111111111", RedactedValue},
+		// Grouped digits failing the checksum are kept.
+		{"msg", "4111 1111 1111 1112", "4111 1111 1111 1112"},
+		{"auth", "Bearer abcdefghijklmnop", RedactedValue},
+	}
+	for _, tt := range tests {
+		fields := redactSecrets(logrus.Fields{tt.key: tt.value})
+		if got := fields[tt.key]; got != tt.want {
+			t.Errorf("redactSecrets(%s=%q) = %q, want %q", tt.key, tt.value, got, tt.want)
+		}
+		_, redacted := fields[RedactedKey]
+		if redacted != (tt.value != tt.want) {
+			t.Errorf("redactSecrets(%s=%q) listed in %s: %v", tt.key, tt.value, RedactedKey, redacted)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package lg
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SecurityLogger is the logger that security events are routed to, such as a
+// sink for SIEM ingestion. When nil, security events are written with the
+// logger of the context. The fields of the events of a request are rewritten
+// as for its other lines, such as by RedactSecrets.
+var SecurityLogger *logrus.Logger
+
+// SecurityEventKey is the field flagging the security events, set to true.
+var SecurityEventKey = "security_event"
+
+// SecurityKindKey is the field holding the kind of the security events of a
+// SecurityDetector, such as auth_failures.
+var SecurityKindKey = "security_kind"
+
+// Security returns the logger for security events of the context, tagged with
+// security_event=true and routed to SecurityLogger. It inherits the fields of
+// the request entry.
+func Security(ctx context.Context) logrus.FieldLogger {
+	return securityLogger(ctx, "")
+}
+
+// securityLogger returns the logger for the security events of the context,
+// with their kind when set.
+func securityLogger(ctx context.Context, kind string) *logrus.Entry {
+	fields := logrus.Fields{SecurityEventKey: true}
+	if kind != "" {
+		fields[SecurityKindKey] = kind
+	}
+	entry := withCaller(contextLogger(ctx), 2).WithFields(fields)
+	if SecurityLogger != nil {
+		entry.Logger = entryLogger(SecurityLogger)
+	}
+	return entry
+}
+
+// SecurityDetector detects suspicious requests in the request logger, and
+// writes a warning security event for each of them, of the kind:
+// auth_failures when a client gets AuthFailures 401 or 403 responses within
+// Window (a minute when zero), path_traversal for request uris trying to
+// escape a directory, and oversized_headers for requests with more than
+// MaxHeaderBytes of headers. A zero threshold disables its detector.
+type SecurityDetector struct {
+	AuthFailures   int
+	Window         time.Duration
+	MaxHeaderBytes int
+
+	mu       sync.Mutex
+	failures map[string]*authFailures
+}
+
+type authFailures struct {
+	count int
+	since time.Time
+}
+
+// NewSecurityDetector returns a detector with sane thresholds: 10 auth
+// failures per minute, and 32KB of headers.
+func NewSecurityDetector() *SecurityDetector {
+	return &SecurityDetector{AuthFailures: 10, Window: time.Minute, MaxHeaderBytes: 32 << 10}
+}
+
+// defaultSecurityWindow is the window of the auth failures of a
+// SecurityDetector when its Window is zero.
+const defaultSecurityWindow = time.Minute
+
+var pathTraversalPatterns = []string{"../", "..\\", "%2e%2e", "%252e%252e", "..%2f", "..%5c", "/etc/passwd"}
+
+// checkRequest detects the suspicious requests when they start.
+func (d *SecurityDetector) checkRequest(ctx context.Context, r *http.Request) {
+	uri := strings.ToLower(r.RequestURI)
+	for _, p := range pathTraversalPatterns {
+		if strings.Contains(uri, p) {
+			securityLogger(ctx, "path_traversal").Warnln("path traversal attempt")
+			break
+		}
+	}
+
+	if d.MaxHeaderBytes > 0 {
+		size := 0
+		for k, vals := range r.Header {
+			for _, v := range vals {
+				size += len(k) + len(v) + 4
+			}
+		}
+		if size > d.MaxHeaderBytes {
+			securityLogger(ctx, "oversized_headers").WithField("header_bytes", size).Warnln("oversized request headers")
+		}
+	}
+}
+
+// checkResponse counts the auth failures of the client of r.
+func (d *SecurityDetector) checkResponse(ctx context.Context, r *http.Request, status int) {
+	if d.AuthFailures <= 0 || (status != http.StatusUnauthorized && status != http.StatusForbidden) {
+		return
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	window := d.Window
+	if window <= 0 {
+		window = defaultSecurityWindow
+	}
+	now := time.Now()
+	d.mu.Lock()
+	if d.failures == nil {
+		d.failures = map[string]*authFailures{}
+	}
+	f, ok := d.failures[ip]
+	if !ok || now.Sub(f.since) > window {
+		f = &authFailures{since: now}
+		d.failures[ip] = f
+	}
+	f.count++
+	count := f.count
+
+	// Forget the clients which haven't failed recently
+	if len(d.failures) > 10000 {
+		for k, v := range d.failures {
+			if now.Sub(v.since) > window {
+				delete(d.failures, k)
+			}
+		}
+	}
+	d.mu.Unlock()
+
+	if count == d.AuthFailures {
+		securityLogger(ctx, "auth_failures").WithFields(logrus.Fields{
+			"client_ip": ip, "auth_failures": count,
+		}).Warnln("repeated auth failures")
+	}
+}
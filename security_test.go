@@ -0,0 +1,21 @@
+package lg
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestSecurityLoggerRewritesFields(t *testing.T) {
+	var sink bytes.Buffer
+	SecurityLogger = logrus.New()
+	SecurityLogger.Out = &sink
+	SecurityLogger.Formatter = &logrus.JSONFormatter{}
+	defer func() { SecurityLogger = nil }()
+
+	checkSink(t, &sink, func(r *http.Request) {
+		Security(r.Context()).WithField("api_key", awsKey).Warnln("leaked key used")
+	})
+}
@@ -0,0 +1,72 @@
+package lg
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ShutdownTimeout is the time given to the requests in flight to complete when
+// Serve shuts the server down.
+var ShutdownTimeout = 30 * time.Second
+
+// Serve runs srv until ctx is done, then shuts it down gracefully, logging
+// the listen address, the shutdown and its duration, and the errors of the
+// server with the logger of ctx, or DefaultLogger. The requests still in
+// flight when the shutdown times out are logged with LogAbortedRequests. The
+// given closers, such as the AsyncWriter or BatchWriter of the logger, are
+// closed last so that their buffered lines are flushed before Serve returns:
+//
+//	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+//	defer stop()
+//	err := lg.Serve(ctx, srv, asyncWriter)
+func Serve(ctx context.Context, srv *http.Server, closers ...io.Closer) error {
+	logger := loggerOrDefault(ctx)
+	defer func() {
+		for _, c := range closers {
+			if err := c.Close(); err != nil {
+				logger.WithError(err).Errorln("flushing logs failed")
+			}
+		}
+	}()
+
+	addr := srv.Addr
+	if addr == "" {
+		addr = ":http"
+	}
+	tls := srv.TLSConfig != nil && (len(srv.TLSConfig.Certificates) > 0 || srv.TLSConfig.GetCertificate != nil)
+	logger.WithFields(logrus.Fields{"addr": addr, "tls": tls}).Infoln("server listening")
+
+	errc := make(chan error, 1)
+	go func() {
+		if tls {
+			errc <- srv.ListenAndServeTLS("", "")
+		} else {
+			errc <- srv.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-errc:
+		logger.WithError(err).WithField("addr", addr).Errorln("server failed")
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.WithField("shutdown_timeout_ms", float64(ShutdownTimeout.Nanoseconds())/1000000.0).Infoln("server shutting down")
+	t1 := time.Now()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	err := srv.Shutdown(shutdownCtx)
+	logger = logger.WithField("shutdown_ms", float64(time.Since(t1).Nanoseconds())/1000000.0)
+	if err != nil {
+		logger.WithError(err).Errorln("server shutdown failed")
+		LogAbortedRequests()
+		return err
+	}
+	logger.Infoln("server stopped")
+	return nil
+}
@@ -0,0 +1,99 @@
+package lg
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// degradeInterval is the interval of the checks of SetupOptions.DegradeLevels.
+const degradeInterval = 100 * time.Millisecond
+
+// SetupOptions are the settings of Setup.
+type SetupOptions struct {
+	// Out is the output of the logger, os.Stderr when nil.
+	Out io.Writer
+
+	// AsyncBuffer, when positive, writes the lines through an AsyncWriter
+	// buffering that many lines, flushed by the cleanup func.
+	AsyncBuffer int
+
+	// DegradeLevels, with AsyncBuffer, stops the debug then the info lines
+	// while the buffer of the AsyncWriter fills up, see
+	// AsyncWriter.DegradeLevels.
+	DegradeLevels bool
+
+	// Options are the options of the request logger, applied over the
+	// settings read from the environment.
+	Options []Option
+}
+
+// Setup creates a logger configured from the environment (see
+// ConfigFromEnv) with the JSON formatter by default, sets it as the
+// DefaultLogger, redirects the standard library logger to it, and returns it
+// with its request logger middleware, and a cleanup func restoring the
+// standard library logger and flushing the logs, to call before exiting. The
+// cleanup func is also registered with logrus.RegisterExitHandler, to run on
+// the fatal lines and the fail-fast mode of the request logger:
+//
+//	logger, requestLogger, cleanup, err := lg.Setup(lg.SetupOptions{})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer cleanup()
+//	r.Use(requestLogger)
+func Setup(opts SetupOptions) (*logrus.Logger, func(next http.Handler) http.Handler, func(), error) {
+	config, err := ConfigFromEnv()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	logger := logrus.New()
+	logger.Formatter = &logrus.JSONFormatter{}
+	if opts.Out != nil {
+		logger.Out = opts.Out
+	}
+	if err := config.Apply(logger); err != nil {
+		return nil, nil, nil, err
+	}
+
+	var async *AsyncWriter
+	stopDegrade := func() {}
+	if opts.AsyncBuffer > 0 {
+		async = NewAsyncWriter(logger.Out, opts.AsyncBuffer)
+		logger.Out = async
+		if opts.DegradeLevels {
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				async.DegradeLevels(ctx, logger, degradeInterval)
+			}()
+			stopDegrade = func() {
+				cancel()
+				<-done
+			}
+		}
+	}
+
+	restoreStdlog := RedirectStdlogOutput(logger)
+	DefaultLogger = logger
+
+	rlConfig := config.RequestLoggerConfig()
+	for _, opt := range opts.Options {
+		opt(&rlConfig)
+	}
+
+	cleanup := func() {
+		restoreStdlog()
+		stopDegrade()
+		if async != nil {
+			async.Close()
+		}
+	}
+	logrus.RegisterExitHandler(cleanup)
+	return logger, RequestLoggerWithConfig(logger, rlConfig), cleanup, nil
+}
@@ -0,0 +1,133 @@
+package lg
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// SigningWriter appends an HMAC to every line written to it, so that audit
+// logs can be verified as untampered with VerifyLines. The HMAC of a line
+// covers the line and the HMAC of the previous line, chaining the lines so
+// that removed or reordered lines are detected too.
+//
+// It's meant to be set as the Out of a logger, which writes each entry in a
+// single call under its lock. JSON lines get an "hmac" field, other lines a
+// trailing hmac=<hex>, and each line of a multi-line entry is signed. The
+// first write of a SigningWriter starts a new chain with a signed
+// {"lg_chain":"start",...} line, so that a file appended to by successive
+// processes can be verified.
+type SigningWriter struct {
+	w   io.Writer
+	key []byte
+
+	mu      sync.Mutex
+	prev    []byte
+	started bool
+}
+
+// chainStart is the prefix of the line starting a chain of HMACs.
+var chainStart = []byte(`{"lg_chain":"start"`)
+
+// NewSigningWriter returns a SigningWriter writing to w, signing with key.
+func NewSigningWriter(w io.Writer, key []byte) *SigningWriter {
+	return &SigningWriter{w: w, key: key}
+}
+
+func (s *SigningWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var buf bytes.Buffer
+	if !s.started {
+		s.started = true
+		s.prev = nil
+		start := append(append([]byte{}, chainStart...), fmt.Sprintf(`,"time":%q}`, time.Now().Format(time.RFC3339Nano))...)
+		s.sign(&buf, start)
+	}
+	for _, line := range bytes.Split(bytes.TrimRight(p, "\n"), []byte("\n")) {
+		s.sign(&buf, line)
+	}
+
+	if _, err := s.w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// sign appends line to buf with its HMAC, chained to the previous line.
+func (s *SigningWriter) sign(buf *bytes.Buffer, line []byte) {
+	sig := signLine(s.key, s.prev, line)
+	s.prev = sig
+	if len(line) > 1 && line[len(line)-1] == '}' {
+		buf.Write(line[:len(line)-1])
+		fmt.Fprintf(buf, `,"hmac":"%x"}`, sig)
+	} else {
+		buf.Write(line)
+		fmt.Fprintf(buf, " hmac=%x", sig)
+	}
+	buf.WriteByte('\n')
+}
+
+// VerifyLines checks the chains of HMACs of the lines written by a
+// SigningWriter with key, restarting at each chain start line. It returns an
+// error for the first line which is not signed or whose HMAC doesn't match.
+func VerifyLines(r io.Reader, key []byte) error {
+	var prev []byte
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 16<<20)
+	for n := 1; sc.Scan(); n++ {
+		line, sig, ok := splitSignedLine(sc.Bytes())
+		if !ok {
+			return fmt.Errorf("lg: line %d is not signed", n)
+		}
+		if bytes.HasPrefix(line, chainStart) {
+			prev = nil
+		}
+		if !hmac.Equal(sig, signLine(key, prev, line)) {
+			return fmt.Errorf("lg: line %d has an invalid signature", n)
+		}
+		prev = sig
+	}
+	return sc.Err()
+}
+
+func signLine(key, prev, line []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(prev)
+	mac.Write(line)
+	return mac.Sum(nil)
+}
+
+// splitSignedLine returns the original line and the signature of a line
+// written by a SigningWriter.
+func splitSignedLine(line []byte) ([]byte, []byte, bool) {
+	const hexLen = sha256.Size * 2
+	if bytes.HasSuffix(line, []byte(`"}`)) {
+		i := len(line) - len(`,"hmac":"`) - hexLen - len(`"}`)
+		if i < 0 || !bytes.HasPrefix(line[i:], []byte(`,"hmac":"`)) {
+			return nil, nil, false
+		}
+		sig, err := hex.DecodeString(string(line[i+len(`,"hmac":"`) : len(line)-2]))
+		if err != nil {
+			return nil, nil, false
+		}
+		orig := append(append([]byte{}, line[:i]...), '}')
+		return orig, sig, true
+	}
+	i := len(line) - len(" hmac=") - hexLen
+	if i < 0 || !bytes.HasPrefix(line[i:], []byte(" hmac=")) {
+		return nil, nil, false
+	}
+	sig, err := hex.DecodeString(string(line[i+len(" hmac="):]))
+	if err != nil {
+		return nil, nil, false
+	}
+	return line[:i], sig, true
+}
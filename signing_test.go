@@ -0,0 +1,38 @@
+package lg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestVerifyLines(t *testing.T) {
+	key := []byte("secret")
+	var buf bytes.Buffer
+
+	// Two processes appending to the same file, the second one with a
+	// multi-line entry.
+	w := NewSigningWriter(&buf, key)
+	w.Write([]byte(`{"msg":"one"}` + "\n"))
+	w.Write([]byte("two\n"))
+	w = NewSigningWriter(&buf, key)
+	w.Write([]byte("12:04:05.123 ERRO GET / 500\n\nPANIC: boom\ngoroutine 1 [running]:\n"))
+
+	if err := VerifyLines(bytes.NewReader(buf.Bytes()), key); err != nil {
+		t.Fatalf("VerifyLines: %v\n%s", err, buf.String())
+	}
+	if err := VerifyLines(bytes.NewReader(buf.Bytes()), []byte("other")); err == nil {
+		t.Error("VerifyLines with another key succeeded")
+	}
+
+	lines := strings.SplitAfter(buf.String(), "\n")
+	tampered := strings.Join(lines, "")
+	tampered = strings.Replace(tampered, `"msg":"one"`, `"msg":"uno"`, 1)
+	if err := VerifyLines(strings.NewReader(tampered), key); err == nil {
+		t.Error("VerifyLines of a modified line succeeded")
+	}
+	removed := strings.Join(append(append([]string{}, lines[:1]...), lines[2:]...), "")
+	if err := VerifyLines(strings.NewReader(removed), key); err == nil {
+		t.Error("VerifyLines with a removed line succeeded")
+	}
+}
@@ -0,0 +1,122 @@
+package lg
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/sirupsen/logrus"
+)
+
+// NewSlogHandler returns a slog.Handler writing into the logger of ctx, so
+// the libraries which accept a *slog.Logger log with the request entry and its
+// fields, such as req_id. Records logged with a context which carries its own
+// lg logger are written to that logger instead. Attribute groups are written
+// as dotted field paths, see FieldPathFormatter.
+func NewSlogHandler(ctx context.Context) slog.Handler {
+	return &slogHandler{ctx: ctx}
+}
+
+type slogHandler struct {
+	ctx    context.Context
+	fields logrus.Fields
+	group  string
+}
+
+func (h *slogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	logger := h.logger(ctx)
+	switch l := logger.(type) {
+	case *logrus.Entry:
+		return loggerLevel(l.Logger) >= slogToLogrusLevel(level)
+	case *logrus.Logger:
+		return loggerLevel(l) >= slogToLogrusLevel(level)
+	}
+	return true
+}
+
+func (h *slogHandler) Handle(ctx context.Context, rec slog.Record) error {
+	fields := make(logrus.Fields, len(h.fields)+rec.NumAttrs())
+	for k, v := range h.fields {
+		fields[k] = v
+	}
+	rec.Attrs(func(a slog.Attr) bool {
+		addSlogAttr(fields, h.group, a)
+		return true
+	})
+
+	logger := h.logger(ctx).WithFields(fields)
+	switch slogToLogrusLevel(rec.Level) {
+	case logrus.DebugLevel:
+		logger.Debug(rec.Message)
+	case logrus.InfoLevel:
+		logger.Info(rec.Message)
+	case logrus.WarnLevel:
+		logger.Warn(rec.Message)
+	default:
+		logger.Error(rec.Message)
+	}
+	return nil
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.fields = make(logrus.Fields, len(h.fields)+len(attrs))
+	for k, v := range h.fields {
+		h2.fields[k] = v
+	}
+	for _, a := range attrs {
+		addSlogAttr(h2.fields, h.group, a)
+	}
+	return &h2
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.group = h.group + name + FieldPathSeparator
+	return &h2
+}
+
+// logger returns the logger of the record context if it carries one, or the
+// logger of the handler context.
+func (h *slogHandler) logger(ctx context.Context) logrus.FieldLogger {
+	if ctx != nil {
+		if _, ok := GetLogEntry(ctx); ok {
+			return contextLogger(ctx)
+		}
+		if _, ok := ctx.Value(LoggerCtxKey).(*logrus.Logger); ok {
+			return contextLogger(ctx)
+		}
+	}
+	return contextLogger(h.ctx)
+}
+
+func addSlogAttr(fields logrus.Fields, prefix string, a slog.Attr) {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + FieldPathSeparator
+		}
+		for _, ga := range v.Group() {
+			addSlogAttr(fields, prefix, ga)
+		}
+		return
+	}
+	if a.Key == "" {
+		return
+	}
+	fields[prefix+a.Key] = v.Any()
+}
+
+func slogToLogrusLevel(level slog.Level) logrus.Level {
+	switch {
+	case level < slog.LevelInfo:
+		return logrus.DebugLevel
+	case level < slog.LevelWarn:
+		return logrus.InfoLevel
+	case level < slog.LevelError:
+		return logrus.WarnLevel
+	}
+	return logrus.ErrorLevel
+}
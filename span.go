@@ -0,0 +1,92 @@
+package lg
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// span is a timed part of a request, such as a database query.
+type span struct {
+	name     string
+	duration time.Duration
+}
+
+// StartSpan starts timing a part of the request of the context, named such as
+// "db" or "render", and returns the function ending it. The durations of the
+// spans are added up per name on the completion line, as span_<name>_ms, and
+// in the Server-Timing header with ServerTiming:
+//
+//	end := lg.StartSpan(ctx, "db")
+//	rows, err := db.QueryContext(ctx, query)
+//	end()
+//
+// It does nothing outside of a request.
+func StartSpan(ctx context.Context, name string) func() {
+	entry, ok := GetLogEntry(ctx)
+	if !ok {
+		return func() {}
+	}
+	entry = entry.root()
+	name = spanName(name)
+	start := time.Now()
+	return func() {
+		entry.mu.Lock()
+		defer entry.mu.Unlock()
+		entry.spans = append(entry.spans, span{name, time.Since(start)})
+	}
+}
+
+// spanName replaces the characters of name which aren't allowed in a
+// Server-Timing metric name and a field key.
+func spanName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '.' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// spanDurations returns the durations of the ended spans of the entry, added
+// up per name, and their names in order.
+func (l *HTTPLoggerEntry) spanDurations() ([]string, map[string]time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var names []string
+	durations := map[string]time.Duration{}
+	for _, s := range l.spans {
+		if _, ok := durations[s.name]; !ok {
+			names = append(names, s.name)
+		}
+		durations[s.name] += s.duration
+	}
+	return names, durations
+}
+
+// spanFields returns the span_<name>_ms fields of the entry.
+func (l *HTTPLoggerEntry) spanFields() logrus.Fields {
+	names, durations := l.spanDurations()
+	fields := logrus.Fields{}
+	for _, name := range names {
+		fields["span_"+name+"_ms"] = float64(durations[name].Nanoseconds()) / 1000000.0
+	}
+	return fields
+}
+
+// serverTiming returns the Server-Timing header of the entry, with its ended
+// spans and its total duration so far.
+func (l *HTTPLoggerEntry) serverTiming() string {
+	names, durations := l.spanDurations()
+	metrics := make([]string, 0, len(names)+1)
+	for _, name := range names {
+		metrics = append(metrics, fmt.Sprintf("%s;dur=%.3f", name, float64(durations[name].Nanoseconds())/1000000.0))
+	}
+	if !l.start.IsZero() {
+		metrics = append(metrics, fmt.Sprintf("total;dur=%.3f", float64(time.Since(l.start).Nanoseconds())/1000000.0))
+	}
+	return strings.Join(metrics, ", ")
+}
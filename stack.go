@@ -0,0 +1,69 @@
+package lg
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// stackMiddleware identifies a middleware of a chi stack by the name of its
+// function, see funcName.
+type stackMiddleware struct {
+	name    string
+	prefix  string
+	before  bool   // must be placed before the request logger, or after it
+	problem string // what goes wrong when misplaced
+}
+
+// stackMiddlewares are the middlewares whose place relative to the request
+// logger matters for the accuracy of its fields.
+var stackMiddlewares = []stackMiddleware{
+	{"RequestID", "middleware.RequestID", true, "req_id is missing from the lines of the request logger"},
+	{"RealIP", "middleware.RealIP", true, "remote_addr is the address of the proxy, not of the client"},
+	{"Recoverer", "middleware.Recoverer", true, "the panics are recovered before reaching the request logger, which logs no panic and stack fields"},
+	{"Compress", "middleware.(*Compressor).Handler", false, "resp_bytes_length is the uncompressed size, and resp_content_encoding is missing"},
+}
+
+// ValidateStack checks the middleware stacks of the routes of r, at startup,
+// for the middlewares placed in an order which breaks the accuracy of the
+// fields of the request logger, such as RequestID or RealIP after it, or
+// Compress before it. The problems are logged as warnings to DefaultLogger,
+// and returned.
+func ValidateStack(r chi.Routes) []string {
+	var problems []string
+	seen := map[string]bool{}
+	chi.Walk(r, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		logger := -1
+		for i, mw := range middlewares {
+			if strings.HasPrefix(funcName(mw), "lg.requestLogger") {
+				logger = i
+				break
+			}
+		}
+		if logger < 0 {
+			return nil
+		}
+		for i, mw := range middlewares {
+			name := funcName(mw)
+			for _, sm := range stackMiddlewares {
+				if !strings.HasPrefix(name, sm.prefix) || (i < logger) == sm.before {
+					continue
+				}
+				place := "after"
+				if !sm.before {
+					place = "before"
+				}
+				problem := fmt.Sprintf("%s is %s the request logger: %s", sm.name, place, sm.problem)
+				if !seen[problem] {
+					seen[problem] = true
+					problems = append(problems, problem)
+					DefaultLogger.WithField("route", method+" "+route).Warnf("lg: %s", problem)
+				}
+			}
+		}
+		return nil
+	})
+	return problems
+}
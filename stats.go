@@ -0,0 +1,32 @@
+package lg
+
+import "sync/atomic"
+
+// Counters are the internal counters of lg, to observe the health of the
+// logging pipeline itself.
+type Counters struct {
+	EntriesWritten  uint64 `json:"entries_written"`  // lines written by the request logger
+	EntriesDropped  uint64 `json:"entries_dropped"`  // lines filtered, skipped or dropped by a full AsyncWriter
+	SampledOut      uint64 `json:"sampled_out"`      // requests sampled out
+	PanicsRecovered uint64 `json:"panics_recovered"` // panics recovered by the request logger, not the intercepted fatal lines
+	SinkErrors      uint64 `json:"sink_errors"`      // failed writes, uploads and inserts of the sinks
+	PipelinePanics  uint64 `json:"pipeline_panics"`  // panics of the hooks, formatters and outputs, recovered by the request logger
+
+	PanicsByRoute map[string]uint64 `json:"panics_by_route"` // panics recovered per method and route pattern
+}
+
+var counters Counters
+
+// Stats returns a snapshot of the internal counters of lg. They can be
+// published with expvar with the lgexpvar package.
+func Stats() Counters {
+	return Counters{
+		EntriesWritten:  atomic.LoadUint64(&counters.EntriesWritten),
+		EntriesDropped:  atomic.LoadUint64(&counters.EntriesDropped),
+		SampledOut:      atomic.LoadUint64(&counters.SampledOut),
+		PanicsRecovered: atomic.LoadUint64(&counters.PanicsRecovered),
+		SinkErrors:      atomic.LoadUint64(&counters.SinkErrors),
+		PipelinePanics:  atomic.LoadUint64(&counters.PipelinePanics),
+		PanicsByRoute:   panicsByRoute(),
+	}
+}
@@ -0,0 +1,107 @@
+package lg
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// StatusPolicy is the logging policy of the completion lines of a response
+// status, such as the 404 and 405 responses, which are mostly the noise of
+// scanners, see RequestLoggerConfig.StatusPolicies.
+type StatusPolicy struct {
+	Level  *logrus.Level // level of the completion lines if set, such as logrus.DebugLevel
+	Skip   bool          // the completion lines are not written
+	Counts *StatusCounts // the responses are counted, to be written periodically
+}
+
+// DefaultStatusCountsInterval is the interval of a StatusCounts created with
+// no interval.
+const DefaultStatusCountsInterval = time.Minute
+
+// StatusCounts counts the responses with a StatusPolicy, and writes a line
+// per status every interval with the number of responses, so they can be
+// skipped and still be accounted for.
+type StatusCounts struct {
+	logger   *logrus.Logger
+	interval time.Duration
+
+	mu     sync.Mutex
+	counts map[int]int
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewStatusCounts returns a StatusCounts writing to logger every interval, or
+// every DefaultStatusCountsInterval if interval is not positive.
+func NewStatusCounts(logger *logrus.Logger, interval time.Duration) *StatusCounts {
+	if interval <= 0 {
+		interval = DefaultStatusCountsInterval
+	}
+	c := &StatusCounts{
+		logger:   logger,
+		interval: interval,
+		counts:   map[int]int{},
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go c.run()
+	return c
+}
+
+func (c *StatusCounts) add(status int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[status]++
+}
+
+func (c *StatusCounts) run() {
+	defer close(c.done)
+	t := time.NewTicker(c.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-c.stop:
+			c.emit()
+			return
+		case <-t.C:
+			c.emit()
+		}
+	}
+}
+
+func (c *StatusCounts) emit() {
+	c.mu.Lock()
+	counts := c.counts
+	c.counts = map[int]int{}
+	c.mu.Unlock()
+
+	for status, n := range counts {
+		c.logger.WithFields(logrus.Fields{
+			"resp_status": status,
+			"requests":    n,
+			"interval_s":  c.interval.Seconds(),
+		}).Infof("%d %s responses", n, http.StatusText(status))
+	}
+}
+
+// Close writes the last counts and stops the aggregation.
+func (c *StatusCounts) Close() error {
+	c.closeOnce.Do(func() { close(c.stop) })
+	<-c.done
+	return nil
+}
+
+// assertStatus logs a warning about the status written by the handler, with
+// StatusAssertions.
+func (l *HTTPLoggerEntry) assertStatus(msg string) {
+	var fields logrus.Fields
+	if route := routePattern(l.req); route != "" {
+		fields = logrus.Fields{"route": route}
+	}
+	l.logWith(fields, logrus.WarnLevel, msg)
+}
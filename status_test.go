@@ -0,0 +1,66 @@
+package lg
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestStatusPolicies(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &buf
+	logger.Formatter = &logrus.JSONFormatter{}
+	logger.Level = logrus.DebugLevel
+
+	debug := logrus.DebugLevel
+	counts := NewStatusCounts(logger, 0)
+	h := RequestLogger(logger,
+		WithStatusPolicy(http.StatusNotFound, StatusPolicy{Level: &debug}),
+		WithStatusPolicy(http.StatusMethodNotAllowed, StatusPolicy{Skip: true, Counts: counts}),
+		WithStatusPolicy(http.StatusTeapot, StatusPolicy{}),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/post":
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		case "/teapot":
+			w.WriteHeader(http.StatusTeapot)
+		}
+	}))
+
+	for _, path := range []string{"/missing", "/post", "/post", "/teapot"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	counts.Close()
+
+	var lines []map[string]interface{}
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var line map[string]interface{}
+		if err := dec.Decode(&line); err != nil {
+			t.Fatal(err)
+		}
+		if line["msg"] != "request started" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3: %v", len(lines), lines)
+	}
+	if lines[0]["level"] != "debug" || lines[0]["resp_status"] != 404.0 {
+		t.Errorf("404 line = %v, want a debug line", lines[0])
+	}
+	// A policy without a level keeps the default level.
+	if lines[1]["level"] != "info" || lines[1]["resp_status"] != 418.0 {
+		t.Errorf("418 line = %v, want an info line", lines[1])
+	}
+	if lines[2]["resp_status"] != 405.0 || lines[2]["requests"] != 2.0 {
+		t.Errorf("counts line = %v, want 2 405 responses", lines[2])
+	}
+}
@@ -0,0 +1,86 @@
+package lg
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// StdlogParser parses a line of the standard library logger written by a known
+// library into a level, message and fields, when ok.
+type StdlogParser func(line string) (level logrus.Level, msg string, fields logrus.Fields, ok bool)
+
+// StdlogParsers are the parsers tried in order on the lines redirected by
+// RedirectStdlogOutput. The lines no parser recognizes are logged as is at
+// the info level.
+var StdlogParsers = []StdlogParser{ParseHTTPServerLine, ParseGRPCLine, ParseMySQLLine}
+
+var (
+	httpTLSError   = regexp.MustCompile(`^http: TLS handshake error from (\S+): (.*)$`)
+	httpPanic      = regexp.MustCompile(`^http: panic serving (\S+): (.*)$`)
+	httpAcceptErr  = regexp.MustCompile(`^http: Accept error: (.*); retrying in (\S+)$`)
+	httpWriteHdr   = regexp.MustCompile(`^http: superfluous response\.WriteHeader call from (\S+)`)
+	grpcLine       = regexp.MustCompile(`^(INFO|WARNING|ERROR|FATAL): (?:\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)? )?(?:\[(\w+)\] )?(.*)$`)
+	mysqlLine      = regexp.MustCompile(`^\[mysql\] (?:\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)? )?(?:(\S+\.go:\d+): )?(.*)$`)
+	grpcLineLevels = map[string]logrus.Level{
+		"INFO": logrus.InfoLevel, "WARNING": logrus.WarnLevel,
+		"ERROR": logrus.ErrorLevel, "FATAL": logrus.ErrorLevel,
+	}
+)
+
+// ParseHTTPServerLine parses the lines of net/http servers without an
+// ErrorLog: TLS handshake errors, recovered panics, accept errors and
+// superfluous WriteHeader calls.
+func ParseHTTPServerLine(line string) (logrus.Level, string, logrus.Fields, bool) {
+	if !strings.HasPrefix(line, "http: ") && !strings.HasPrefix(line, "http2: ") {
+		return 0, "", nil, false
+	}
+	fields := logrus.Fields{ComponentKey: "net/http"}
+	if m := httpTLSError.FindStringSubmatch(line); m != nil {
+		fields["remote_addr"], fields["error"] = m[1], m[2]
+		return logrus.WarnLevel, "TLS handshake error", fields, true
+	}
+	if m := httpPanic.FindStringSubmatch(line); m != nil {
+		fields["remote_addr"], fields["panic"] = m[1], m[2]
+		return logrus.ErrorLevel, "panic serving request", fields, true
+	}
+	if m := httpAcceptErr.FindStringSubmatch(line); m != nil {
+		fields["error"], fields["retry_in"] = m[1], m[2]
+		return logrus.ErrorLevel, "accept error", fields, true
+	}
+	if m := httpWriteHdr.FindStringSubmatch(line); m != nil {
+		fields["caller"] = m[1]
+		return logrus.WarnLevel, "superfluous response.WriteHeader call", fields, true
+	}
+	return logrus.WarnLevel, line, fields, true
+}
+
+// ParseGRPCLine parses the lines of the grpc-go logger, such as
+// "WARNING: 2018/08/21 12:00:00 [core] grpc: addrConn.createTransport failed".
+func ParseGRPCLine(line string) (logrus.Level, string, logrus.Fields, bool) {
+	m := grpcLine.FindStringSubmatch(line)
+	if m == nil {
+		return 0, "", nil, false
+	}
+	fields := logrus.Fields{ComponentKey: "grpc"}
+	if m[2] != "" {
+		fields["grpc_component"] = m[2]
+	}
+	return grpcLineLevels[m[1]], m[3], fields, true
+}
+
+// ParseMySQLLine parses the lines of the go-sql-driver/mysql driver of
+// database/sql, which are errors, such as
+// "[mysql] 2018/08/21 12:00:00 packets.go:36: unexpected EOF".
+func ParseMySQLLine(line string) (logrus.Level, string, logrus.Fields, bool) {
+	m := mysqlLine.FindStringSubmatch(line)
+	if m == nil {
+		return 0, "", nil, false
+	}
+	fields := logrus.Fields{ComponentKey: "mysql"}
+	if m[1] != "" {
+		fields["caller"] = m[1]
+	}
+	return logrus.ErrorLevel, m[2], fields, true
+}
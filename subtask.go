@@ -0,0 +1,83 @@
+package lg
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Sub returns a context with a child entry of the request entry of ctx for a
+// subtask of the request, such as a job of a fan-out. The lines logged
+// through Log(ctx) with it carry the fields of the request entry and the
+// subtask and subtask_id fields, and the fields set on it with SetEntryField
+// don't leak to the request entry or the other subtasks. With SubtaskRollup,
+// the completion line of the request lists the subtasks and their fields
+// under subtasks.
+//
+// Outside of a request, the subtask fields are set on a copy of the fields of
+// the context.
+func Sub(ctx context.Context, task string, id interface{}) context.Context {
+	fields := logrus.Fields{"subtask": task, "subtask_id": id}
+
+	parent, ok := GetLogEntry(ctx)
+	if !ok {
+		if _, ok := ctx.Value(LoggerCtxKey).(*logrus.Logger); !ok {
+			return ctx
+		}
+		cf := &contextFields{}
+		if data := EntryFields(ctx); len(data) > 0 {
+			cf.set(data)
+		}
+		cf.set(fields)
+		return context.WithValue(ctx, fieldsCtxKey, cf)
+	}
+
+	parent.mu.Lock()
+	child := &HTTPLoggerEntry{
+		Logger:  parent.Logger.WithFields(fields),
+		config:  parent.conf(),
+		req:     parent.req,
+		resp:    parent.resp,
+		parent:  parent,
+		quiet:   parent.quiet,
+		demoted: parent.demoted,
+	}
+	if e, ok := parent.Logger.(*logrus.Entry); ok {
+		child.base = e.Data
+	}
+	if parent.conf().SubtaskRollup {
+		parent.subtasks = append(parent.subtasks, child)
+	}
+	parent.mu.Unlock()
+
+	return WithLogEntry(ctx, child)
+}
+
+// root returns the request entry of a subtask entry, or the entry itself, to
+// record what's written on the completion line of the request.
+func (l *HTTPLoggerEntry) root() *HTTPLoggerEntry {
+	for l.parent != nil {
+		l = l.parent
+	}
+	return l
+}
+
+// subtaskFields returns the subtasks of the entry with the fields set on
+// them, for the completion line.
+func (l *HTTPLoggerEntry) subtaskFields() []logrus.Fields {
+	l.mu.Lock()
+	subtasks := l.subtasks
+	l.mu.Unlock()
+
+	var list []logrus.Fields
+	for _, sub := range subtasks {
+		fields := logrus.Fields{}
+		for k, v := range sub.fields() {
+			if _, ok := sub.base[k]; !ok {
+				fields[k] = v
+			}
+		}
+		list = append(list, fields)
+	}
+	return list
+}
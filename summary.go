@@ -0,0 +1,144 @@
+package lg
+
+import (
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// summarySamples is the number of durations kept per route and interval to
+// compute the latency percentiles of the traffic summary.
+const summarySamples = 10000
+
+// TrafficSummary aggregates the completed requests and writes a summary line
+// per route every interval, with the request and error counts and the p50,
+// p95 and p99 latencies, so a low-cardinality overview of the traffic exists
+// even when the request lines are sampled away. Set its OnComplete method as
+// the OnComplete of the request logger.
+type TrafficSummary struct {
+	logger   *logrus.Logger
+	interval time.Duration
+
+	mu     sync.Mutex
+	routes map[string]*routeSummary
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type routeSummary struct {
+	requests  int
+	errors    int
+	durations []float64
+}
+
+// DefaultTrafficSummaryInterval is the interval of a TrafficSummary created
+// with no interval.
+const DefaultTrafficSummaryInterval = time.Minute
+
+// NewTrafficSummary returns a TrafficSummary writing to logger every interval,
+// or every DefaultTrafficSummaryInterval if interval is not positive.
+func NewTrafficSummary(logger *logrus.Logger, interval time.Duration) *TrafficSummary {
+	if interval <= 0 {
+		interval = DefaultTrafficSummaryInterval
+	}
+	s := &TrafficSummary{
+		logger:   logger,
+		interval: interval,
+		routes:   map[string]*routeSummary{},
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// OnComplete records a completed request, see RequestLoggerConfig.OnComplete.
+func (s *TrafficSummary) OnComplete(r *http.Request, status, bytes int, elapsed time.Duration, fields logrus.Fields) {
+	route := routePattern(r)
+	if route == "" {
+		route = "*"
+	}
+	key := r.Method + " " + route
+	ms := float64(elapsed.Nanoseconds()) / 1000000.0
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rs, ok := s.routes[key]
+	if !ok {
+		rs = &routeSummary{}
+		s.routes[key] = rs
+	}
+	rs.requests++
+	if status >= 500 {
+		rs.errors++
+	}
+	// Keep a uniform sample of the durations once the limit is reached
+	if len(rs.durations) < summarySamples {
+		rs.durations = append(rs.durations, ms)
+	} else if i := rand.Intn(rs.requests); i < summarySamples {
+		rs.durations[i] = ms
+	}
+}
+
+func (s *TrafficSummary) run() {
+	defer close(s.done)
+	t := time.NewTicker(s.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.stop:
+			s.emit()
+			return
+		case <-t.C:
+			s.emit()
+		}
+	}
+}
+
+func (s *TrafficSummary) emit() {
+	s.mu.Lock()
+	routes := s.routes
+	s.routes = map[string]*routeSummary{}
+	s.mu.Unlock()
+
+	for key, rs := range routes {
+		sort.Float64s(rs.durations)
+		s.logger.WithFields(logrus.Fields{
+			"route":      key,
+			"requests":   rs.requests,
+			"errors":     rs.errors,
+			"p50_ms":     percentile(rs.durations, 0.50),
+			"p95_ms":     percentile(rs.durations, 0.95),
+			"p99_ms":     percentile(rs.durations, 0.99),
+			"interval_s": s.interval.Seconds(),
+		}).Infoln("traffic summary")
+	}
+}
+
+// Close writes the last summary and stops the aggregation.
+func (s *TrafficSummary) Close() error {
+	s.closeOnce.Do(func() { close(s.stop) })
+	<-s.done
+	return nil
+}
+
+// percentile returns the p-th percentile of sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(p*float64(len(sorted))+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
@@ -0,0 +1,223 @@
+package lg
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// AccessRecord is a completed request with a fixed schema, for columnar
+// stores such as ClickHouse or BigQuery. Fields holds the other fields of the
+// entry, stored as a JSON column.
+type AccessRecord struct {
+	Time     time.Time
+	Method   string
+	Route    string
+	Status   int
+	Duration time.Duration
+	ReqID    string
+	User     string
+	Fields   map[string]interface{}
+}
+
+// RecordInserter inserts a batch of access records into a table.
+type RecordInserter interface {
+	InsertRecords(ctx context.Context, records []AccessRecord) error
+}
+
+// TableSink batches the completed requests as access records and inserts
+// them with a RecordInserter, every size records or every interval. One batch
+// is inserted at a time: the records completed meanwhile are kept for the
+// next one, up to size, beyond which they're dropped. Set its OnComplete
+// method as the OnComplete of the request logger:
+//
+//	sink := lg.NewTableSink(&lg.SQLInserter{DB: db, Table: "access_log"}, 1000, 5*time.Second)
+//	r.Use(lg.RequestLogger(logger, lg.WithOnComplete(sink.OnComplete)))
+type TableSink struct {
+	inserter RecordInserter
+	size     int
+
+	mu        sync.Mutex
+	records   []AccessRecord
+	inserting bool
+	flushes   sync.WaitGroup
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// DefaultTableSinkInterval is the interval of a TableSink created with no
+// interval.
+const DefaultTableSinkInterval = 5 * time.Second
+
+// NewTableSink returns a TableSink inserting with inserter, every
+// DefaultTableSinkInterval if interval is not positive.
+func NewTableSink(inserter RecordInserter, size int, interval time.Duration) *TableSink {
+	if interval <= 0 {
+		interval = DefaultTableSinkInterval
+	}
+	s := &TableSink{
+		inserter: inserter,
+		size:     size,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go s.run(interval)
+	return s
+}
+
+// tableSinkKeys are the fields stored in the columns of the access records,
+// or which are already part of the request, rather than in their Fields.
+var tableSinkKeys = map[string]bool{
+	"req_id": true, "user": true, "user_id": true, "http_method": true, "uri": true,
+	"resp_status": true, "resp_elapsed_ms": true,
+}
+
+// OnComplete records a completed request, see RequestLoggerConfig.OnComplete.
+func (s *TableSink) OnComplete(r *http.Request, status, bytes int, elapsed time.Duration, fields logrus.Fields) {
+	rec := AccessRecord{
+		Time:     time.Now().Add(-elapsed),
+		Method:   r.Method,
+		Route:    routePattern(r),
+		Status:   status,
+		Duration: elapsed,
+		Fields:   map[string]interface{}{},
+	}
+	rec.ReqID, _ = fields["req_id"].(string)
+	if user, ok := fields["user"]; ok {
+		rec.User = fmt.Sprint(user)
+	} else if user, ok := fields["user_id"]; ok {
+		rec.User = fmt.Sprint(user)
+	}
+	for k, v := range fields {
+		if !tableSinkKeys[k] {
+			rec.Fields[k] = v
+		}
+	}
+
+	s.mu.Lock()
+	if s.inserting && len(s.records) >= s.size {
+		s.mu.Unlock()
+		atomic.AddUint64(&counters.EntriesDropped, 1)
+		return
+	}
+	s.records = append(s.records, rec)
+	if len(s.records) >= s.size {
+		s.flush()
+	}
+	s.mu.Unlock()
+}
+
+func (s *TableSink) run(interval time.Duration) {
+	defer close(s.done)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-t.C:
+			s.mu.Lock()
+			s.flush()
+			s.mu.Unlock()
+		}
+	}
+}
+
+// flush inserts the pending records in the background, unless an insert is
+// in flight.
+func (s *TableSink) flush() {
+	if len(s.records) == 0 || s.inserting {
+		return
+	}
+	records := s.records
+	s.records = nil
+
+	s.inserting = true
+	s.flushes.Add(1)
+	go func() {
+		defer s.flushes.Done()
+		defer func() {
+			s.mu.Lock()
+			s.inserting = false
+			s.mu.Unlock()
+		}()
+		if err := s.inserter.InsertRecords(context.Background(), records); err != nil {
+			atomic.AddUint64(&counters.SinkErrors, 1)
+			fmt.Fprintf(os.Stderr, "lg: failed to insert %d access records: %v\n", len(records), err)
+		}
+	}()
+}
+
+// Close inserts the pending records and waits for the pending inserts.
+func (s *TableSink) Close() error {
+	s.closeOnce.Do(func() { close(s.stop) })
+	<-s.done
+
+	for {
+		s.flushes.Wait()
+		s.mu.Lock()
+		inserting := s.inserting
+		s.flush()
+		s.mu.Unlock()
+		if !inserting {
+			break
+		}
+	}
+	s.flushes.Wait()
+	return nil
+}
+
+// SQLInserter inserts access records with database/sql, in a single multi-row
+// INSERT per batch, which suits ClickHouse through its database/sql driver.
+// The table must have the columns ts, method, route, status, duration_ms,
+// req_id, user and fields, the latter holding JSON.
+type SQLInserter struct {
+	DB    *sql.DB
+	Table string
+}
+
+func (ins *SQLInserter) InsertRecords(ctx context.Context, records []AccessRecord) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "INSERT INTO %s (ts, method, route, status, duration_ms, req_id, user, fields) VALUES ", ins.Table)
+	args := make([]interface{}, 0, len(records)*8)
+	for i, rec := range records {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("(?, ?, ?, ?, ?, ?, ?, ?)")
+		fields, err := json.Marshal(jsonFields(rec.Fields))
+		if err != nil {
+			fields = []byte("{}")
+		}
+		args = append(args, rec.Time, rec.Method, rec.Route, rec.Status,
+			float64(rec.Duration.Nanoseconds())/1000000.0, rec.ReqID, rec.User, string(fields))
+	}
+	_, err := ins.DB.ExecContext(ctx, b.String(), args...)
+	return err
+}
+
+// jsonFields returns the fields encoded to JSON one by one, with the errors as
+// their message, leaving out the fields which can't be encoded rather than
+// failing the whole record.
+func jsonFields(fields map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		b, err := json.Marshal(fieldValue(v))
+		if err != nil {
+			continue
+		}
+		out[k] = json.RawMessage(b)
+	}
+	return out
+}
@@ -0,0 +1,64 @@
+package lg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type recordingInserter struct {
+	mu      sync.Mutex
+	records []AccessRecord
+}
+
+func (ins *recordingInserter) InsertRecords(ctx context.Context, records []AccessRecord) error {
+	ins.mu.Lock()
+	defer ins.mu.Unlock()
+	ins.records = append(ins.records, records...)
+	return nil
+}
+
+// TestTableSinkRewritesFields checks that the access records get the fields
+// of the entry as rewritten for its lines.
+func TestTableSinkRewritesFields(t *testing.T) {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	ins := &recordingInserter{}
+	sink := NewTableSink(ins, 100, time.Hour)
+
+	h := RequestLogger(logger, WithRedactSecrets(), WithOnComplete(sink.OnComplete))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetEntryField(r.Context(), "api_key", awsKey)
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	sink.Close()
+
+	if len(ins.records) != 1 {
+		t.Fatalf("%d records, want 1", len(ins.records))
+	}
+	b, _ := json.Marshal(ins.records[0].Fields)
+	if v, ok := ins.records[0].Fields["api_key"]; !ok || v == awsKey {
+		t.Errorf("api_key not redacted in %s", b)
+	}
+}
+
+func TestJSONFields(t *testing.T) {
+	b, err := json.Marshal(jsonFields(map[string]interface{}{
+		"err":  errors.New("failed"),
+		"ch":   make(chan int),
+		"user": "ann",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), `{"err":"failed","user":"ann"}`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
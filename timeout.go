@@ -0,0 +1,36 @@
+package lg
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/sirupsen/logrus"
+)
+
+// Timeout is a drop-in replacement for chi's middleware.Timeout, to be placed
+// after the request logger. When the handler is still running at the
+// deadline, the request entry is flagged with timed_out=true, the timeout and
+// the time the handler eventually took to return, and is written at least at
+// the warning level, instead of showing up as a plain 504.
+func Timeout(timeout time.Duration) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			t1 := time.Now()
+			next.ServeHTTP(w, r)
+
+			if r.Context().Err() == context.DeadlineExceeded {
+				SetEntryFields(r.Context(), logrus.Fields{
+					"timed_out":          true,
+					"timeout_ms":         float64(timeout.Nanoseconds()) / 1000000.0,
+					"handler_elapsed_ms": float64(time.Since(t1).Nanoseconds()) / 1000000.0,
+				})
+				if entry, ok := GetLogEntry(r.Context()); ok {
+					entry.setLevelIfUnset(logrus.WarnLevel)
+				}
+			}
+		}
+		return middleware.Timeout(timeout)(http.HandlerFunc(fn))
+	}
+}
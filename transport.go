@@ -0,0 +1,209 @@
+package lg
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/sirupsen/logrus"
+)
+
+var callCtxKey = &contextKey{"OutboundCall"}
+
+// Transport is an http.RoundTripper logging the outbound requests with the
+// logger of their context, or DefaultLogger. Each attempt is logged with its
+// attempt number and a call_id shared by all the attempts of the call, and
+// calls retried by the transport end with a summary line. The requests made
+// while serving a request are logged with its id as parent_req_id, and counted
+// on its completion line as outbound_calls and outbound_ms.
+type Transport struct {
+	// Next is the transport making the requests, nil meaning
+	// http.DefaultTransport.
+	Next http.RoundTripper
+
+	// Retries is the number of times a failed request is retried, after
+	// waiting Backoff multiplied by the attempt number. Requests with a body
+	// are only retried if their GetBody is set.
+	Retries int
+	Backoff time.Duration
+
+	// ServiceName is the name of the service making the requests. When set,
+	// it's sent in the CallingServiceHeader of the requests, along with their
+	// depth in the call chain in the DepthHeader, so that internal call
+	// graphs can be rebuilt from the logs.
+	ServiceName string
+
+	// RetryIf reports whether an attempt failed and should be retried. By
+	// default, errors and 5xx responses are retried, for the idempotent
+	// requests only, see idempotent, so that side effects aren't repeated.
+	RetryIf func(resp *http.Response, err error) bool
+}
+
+// outboundCall is the state of a call shared by its attempts.
+type outboundCall struct {
+	id       string
+	attempts int64
+	start    time.Time
+}
+
+// WithOutboundCall returns a context for the attempts of an outbound call
+// made through a Transport by a retry logic of its own, so that the attempts
+// share the same call_id and are numbered. The returned done func writes the
+// summary line of the call, once the retries are over.
+func WithOutboundCall(ctx context.Context) (context.Context, func(resp *http.Response, err error)) {
+	call := &outboundCall{id: newCallID(), start: time.Now()}
+	return context.WithValue(ctx, callCtxKey, call), func(resp *http.Response, err error) {
+		call.logSummary(ctx, resp, err)
+	}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	call, shared := ctx.Value(callCtxKey).(*outboundCall)
+	if !shared {
+		call = &outboundCall{id: newCallID(), start: time.Now()}
+	}
+	next := t.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	// RoundTrip must not modify the request of the caller.
+	req = req.Clone(ctx)
+	if t.ServiceName != "" {
+		req.Header.Set(DepthHeader, strconv.Itoa(outboundDepth(ctx)))
+		req.Header.Set(CallingServiceHeader, t.ServiceName)
+	}
+	retryIf := t.RetryIf
+	if retryIf == nil {
+		retry := idempotent(req)
+		retryIf = func(resp *http.Response, err error) bool {
+			return retry && (err != nil || resp.StatusCode >= 500)
+		}
+	}
+
+	for i := 0; ; i++ {
+		attempt := atomic.AddInt64(&call.attempts, 1)
+		t1 := time.Now()
+		resp, err := next.RoundTrip(req)
+
+		fields := logrus.Fields{
+			"call_id":        call.id,
+			"attempt":        attempt,
+			"out_method":     req.Method,
+			"out_url":        outURL(req.URL),
+			"out_elapsed_ms": float64(time.Since(t1).Nanoseconds()) / 1000000.0,
+		}
+		if resp != nil {
+			fields["out_status"] = resp.StatusCode
+		}
+		if parentID := middleware.GetReqID(ctx); parentID != "" {
+			fields["parent_req_id"] = parentID
+		}
+		if entry, ok := GetLogEntry(ctx); ok {
+			entry.addOutbound(time.Since(t1))
+		}
+		logger := loggerOrDefault(ctx).WithFields(fields)
+		if err != nil {
+			logger.WithError(err).Warnln("outbound request failed")
+		} else {
+			logger.Infoln("outbound request")
+		}
+
+		var ok bool
+		if i < t.Retries && retryIf(resp, err) {
+			req, ok = t.rewind(req)
+		}
+		if !ok {
+			if !shared && t.Retries > 0 {
+				call.logSummary(ctx, resp, err)
+			}
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			if !shared {
+				call.logSummary(ctx, nil, ctx.Err())
+			}
+			return nil, ctx.Err()
+		case <-time.After(t.Backoff * time.Duration(i+1)):
+		}
+	}
+}
+
+// rewind returns a copy of req with its body reset for another attempt, it
+// reports whether the request can be retried.
+func (t *Transport) rewind(req *http.Request) (*http.Request, bool) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, true
+	}
+	if req.GetBody == nil {
+		return req, false
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return req, false
+	}
+	req = req.Clone(req.Context())
+	req.Body = body
+	return req, true
+}
+
+// idempotent reports whether req can be sent again without repeating side
+// effects: the safe methods, and the requests with an idempotency key, the
+// same as for the retries of net/http.
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	if _, ok := req.Header["Idempotency-Key"]; ok {
+		return true
+	}
+	_, ok := req.Header["X-Idempotency-Key"]
+	return ok
+}
+
+// outURL returns the URL of an outbound request for the logs, without its
+// query, which may hold tokens such as the signatures of presigned URLs, and
+// with its password redacted.
+func outURL(u *url.URL) string {
+	c := *u
+	c.RawQuery = ""
+	c.ForceQuery = false
+	return c.Redacted()
+}
+
+// logSummary writes the summary line of the call with its final outcome.
+func (c *outboundCall) logSummary(ctx context.Context, resp *http.Response, err error) {
+	fields := logrus.Fields{
+		"call_id":        c.id,
+		"attempts":       atomic.LoadInt64(&c.attempts),
+		"out_elapsed_ms": float64(time.Since(c.start).Nanoseconds()) / 1000000.0,
+	}
+	if resp != nil {
+		fields["out_status"] = resp.StatusCode
+	}
+	logger := loggerOrDefault(ctx).WithFields(fields)
+	if err != nil {
+		logger.WithError(err).Warnln("outbound call failed")
+		return
+	}
+	logger.Infoln("outbound call complete")
+}
+
+// newCallID returns a random id for an outbound call.
+func newCallID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
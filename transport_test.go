@@ -0,0 +1,112 @@
+package lg
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestTransportRetries(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		method   string
+		header   string
+		attempts int
+	}{
+		{"get", "GET", "", 3},
+		{"post", "POST", "", 1},
+		{"post with idempotency key", "POST", "Idempotency-Key", 3},
+		{"delete", "DELETE", "", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			bodies = nil
+			mu.Unlock()
+
+			var buf bytes.Buffer
+			logger := logrus.New()
+			logger.Out = &buf
+			ctx := WithLoggerContext(context.Background(), logger)
+			client := &http.Client{Transport: &Transport{Retries: 2, ServiceName: "api"}}
+
+			req, _ := http.NewRequest(tt.method, srv.URL, strings.NewReader("payload"))
+			if tt.header != "" {
+				req.Header.Set(tt.header, "abc")
+			}
+			body := req.Body
+			resp, err := client.Do(req.WithContext(ctx))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(bodies) != tt.attempts {
+				t.Fatalf("%d attempts, want %d", len(bodies), tt.attempts)
+			}
+			for i, b := range bodies {
+				if b != "payload" {
+					t.Errorf("attempt %d sent body %q, want %q", i+1, b, "payload")
+				}
+			}
+			if req.Body != body {
+				t.Error("the body of the request was replaced")
+			}
+			if h := req.Header.Get(CallingServiceHeader); h != "" {
+				t.Errorf("%s set to %q on the request", CallingServiceHeader, h)
+			}
+			if n := strings.Count(buf.String(), "outbound request"); n != tt.attempts {
+				t.Errorf("%d attempts logged, want %d", n, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestTransportRedactsURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &buf
+	ctx := WithLoggerContext(context.Background(), logger)
+	client := &http.Client{Transport: &Transport{}}
+
+	u := strings.Replace(srv.URL, "http://", "http://user:secret@", 1) + "/file?X-Amz-Signature=token"
+	req, _ := http.NewRequest("GET", u, nil)
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	out := buf.String()
+	for _, secret := range []string{"secret", "token"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("%q logged in %s", secret, out)
+		}
+	}
+	if !strings.Contains(out, "/file") {
+		t.Errorf("out_url missing from %s", out)
+	}
+}
@@ -0,0 +1,87 @@
+package lg
+
+import (
+	"fmt"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TruncatedKey is the field listing the keys of the fields which have been
+// truncated to fit the size limits of the request logger.
+var TruncatedKey = "_truncated"
+
+// truncateFields shortens the values of fields to maxField characters, then
+// the largest values until the sum of the keys and values fits in maxEntry.
+// A limit of zero is ignored.
+func truncateFields(fields logrus.Fields, maxField, maxEntry int) logrus.Fields {
+	if maxField <= 0 && maxEntry <= 0 {
+		return fields
+	}
+
+	var truncated []string
+	sizes := make(map[string]int, len(fields))
+	total := 0
+	for k, v := range fields {
+		s, ok := v.(string)
+		if !ok {
+			s = fmt.Sprint(v)
+		}
+		if maxField > 0 && len(s) > maxField {
+			s = truncateString(s, maxField)
+			fields[k] = s
+			truncated = append(truncated, k)
+		}
+		sizes[k] = len(s)
+		total += len(k) + len(s)
+	}
+
+	if maxEntry > 0 && total > maxEntry {
+		keys := make([]string, 0, len(sizes))
+		for k := range sizes {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return sizes[keys[i]] > sizes[keys[j]] })
+
+		for _, k := range keys {
+			if total <= maxEntry {
+				break
+			}
+			n := sizes[k] - (total - maxEntry)
+			if n < 0 {
+				n = 0
+			}
+			truncated = appendKey(truncated, k)
+			s := truncateString(fmt.Sprint(fields[k]), n)
+			fields[k] = s
+			total -= sizes[k] - len(s)
+		}
+	}
+
+	if len(truncated) > 0 {
+		sort.Strings(truncated)
+		fields[TruncatedKey] = truncated
+	}
+	return fields
+}
+
+// truncateString cuts s to at most n bytes, without splitting a rune.
+func truncateString(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func appendKey(keys []string, key string) []string {
+	for _, k := range keys {
+		if k == key {
+			return keys
+		}
+	}
+	return append(keys, key)
+}
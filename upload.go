@@ -0,0 +1,45 @@
+package lg
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// countingBody counts the bytes read from a request body, logging the
+// progress of the upload every interval, if set.
+type countingBody struct {
+	io.ReadCloser
+	entry    *HTTPLoggerEntry
+	interval time.Duration
+	start    time.Time
+	last     time.Time
+	n        int64
+}
+
+func newCountingBody(body io.ReadCloser, entry *HTTPLoggerEntry, interval time.Duration) *countingBody {
+	now := time.Now()
+	return &countingBody{ReadCloser: body, entry: entry, interval: interval, start: now, last: now}
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	total := atomic.AddInt64(&b.n, int64(n))
+	if b.interval > 0 && n > 0 {
+		if now := time.Now(); now.Sub(b.last) >= b.interval {
+			b.last = now
+			b.entry.logWith(logrus.Fields{
+				"req_bytes_received": total,
+				"upload_elapsed_ms":  float64(now.Sub(b.start).Nanoseconds()) / 1000000.0,
+			}, logrus.InfoLevel, "upload progress")
+		}
+	}
+	return n, err
+}
+
+// bytesRead returns the number of bytes read so far.
+func (b *countingBody) bytesRead() int64 {
+	return atomic.LoadInt64(&b.n)
+}
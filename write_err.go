@@ -0,0 +1,28 @@
+package lg
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"syscall"
+)
+
+// setWriteErr records the first error writing the response body.
+func (l *HTTPLoggerEntry) setWriteErr(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.writeErr == nil {
+		l.writeErr = err
+	}
+}
+
+// isClientAbort reports whether the write error err is caused by the client
+// going away, rather than by a problem of the server.
+func isClientAbort(err error) bool {
+	if errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, context.Canceled) {
+		return true
+	}
+	// The HTTP/2 server doesn't wrap the errors of the closed streams.
+	msg := err.Error()
+	return strings.Contains(msg, "stream closed") || strings.Contains(msg, "client disconnected")
+}
@@ -0,0 +1,77 @@
+package lg
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Writer returns a writer which logs every line written to it at the given
+// level, with the logger of ctx, so the output of libraries which only take an
+// io.Writer (exec.Cmd stdout and stderr, template engines, etc.) carries the
+// fields of the request. Close writes the last line if it isn't terminated by
+// a newline.
+func Writer(ctx context.Context, level logrus.Level) io.WriteCloser {
+	return &lineWriter{ctx: ctx, level: level}
+}
+
+type lineWriter struct {
+	ctx   context.Context
+	level logrus.Level
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.writeLine(w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+func (w *lineWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.buf) > 0 {
+		w.writeLine(w.buf)
+		w.buf = nil
+	}
+	return nil
+}
+
+func (w *lineWriter) writeLine(line []byte) {
+	line = bytes.TrimSuffix(line, []byte{'\r'})
+	logAtLevel(contextLogger(w.ctx), w.level, string(line))
+}
+
+// logAtLevel writes msg with logger at the given level.
+func logAtLevel(logger logrus.FieldLogger, level logrus.Level, msg string) {
+	switch level {
+	case logrus.DebugLevel:
+		logger.Debug(msg)
+	case logrus.InfoLevel:
+		logger.Info(msg)
+	case logrus.WarnLevel:
+		logger.Warn(msg)
+	case logrus.ErrorLevel:
+		logger.Error(msg)
+	case logrus.FatalLevel:
+		logger.Fatal(msg)
+	case logrus.PanicLevel:
+		logger.Panic(msg)
+	}
+}